@@ -55,6 +55,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"container/heap"
+	"encoding/binary"
 	"fmt"
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
@@ -64,9 +65,11 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"os"
 	"os/user"
 	"path"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
@@ -107,6 +110,34 @@ Data Source
 
   -input           Read XML from file instead of stdin
 
+Record Selection
+
+  -skip-records    Number of leading records to ignore
+  -limit           Maximum number of non-empty results to write
+  -sample          Random sample of records, kept in original order
+  -seed            Seed for reproducible -sample
+  -unique-by       One record per key, e.g., MedlineCitation/PMID [first|last]
+  -sort-by         Write whole records in key order, e.g., MedlineCitation/PMID
+
+  Reading stops as soon as the -limit result is written, so records rejected
+  by -if do not count. Selected records are numbered consecutively for -ident.
+  -unique-by keeps the first record for each key that has output, unless last
+  is given. Keys spill to sorted temporary files when they exceed 128 MB.
+  -sort-by takes only -pattern, plus -head and -tail, and compares digits
+  numerically. Records without the key are placed last. Sorted runs spill to
+  temporary files for large inputs.
+
+Argument Files
+
+  -script          Read arguments from file
+
+Argument File Directives
+
+  # comment        Pound sign followed by space or end of line
+  -include         Insert contents of another argument file
+  -define          Name of macro, followed by arguments up to -end
+  -use             Insert arguments of named macro
+
 Exploration Argument Hierarchy
 
   -pattern         Name of record within set
@@ -138,6 +169,7 @@ String Constraints
   -starts-with     Substring must be at beginning
   -ends-with       Substring must be at end
   -is-not          String must not match
+  -in-lookup       String must be a -lookup key
 
 Numeric Constraints
 
@@ -161,6 +193,15 @@ Format Customization
   -def             Default placeholder for missing fields
   -lbl             Insert arbitrary text
 
+Value Arrangement
+
+  -order           Sort values [asc|desc|num|num-desc]
+  -distinct        Remove duplicate values
+  -keep            Keep first N values, e.g., 3 or "3:et al."
+
+  Arrangement applies to the values of each subsequent -element argument, and
+  is cleared by -rst. -distinct comparisons are case-sensitive.
+
 Element Selection
 
   -element         Print all items that match tag name
@@ -175,6 +216,10 @@ Element Selection
   Parent/Child     MedlineCitation/PMID
   Attribute        DescriptorName@MajorTopicYN
   Recursive        "**/Gene-commentary_accession"
+  Enclosing Object "../Year"
+  Named Ancestor   "..PubmedArticle/MedlineCitation/PMID"
+  Next Sibling     ">Author/LastName"
+  Prior Sibling    "<Author/LastName"
   Object Count     "#Author"
   Item Length      "%Title"
   Element Depth    "^PMID"
@@ -187,6 +232,32 @@ Special -element Operations
   Children         "$"
   Attributes       "@"
 
+Variable Expressions
+
+  Computed Value   -LEN "[&STOP - &START + 1]"
+  Element Value    -KB "[Length / 1000]"
+  Arithmetic       + - * / %
+  Comparison       == != < <= > >=
+  Logical          && || !
+  Functions        min max abs round floor ceil len concat
+  Choice           -SIZE "[if(&LEN > 1000, 'large', 'small')]"
+
+  Integer division gives a floating-point result only if not exact.
+  Element names yield their first value, and #Name gives the number of them.
+  Put spaces around minus after a name.
+  A missing or non-numeric operand leaves the variable unset.
+
+Persistent Variables
+
+  -persist         Variables kept from one record to the next, e.g., TOTAL=0,PREV=
+
+  -persist TOTAL=0,PREV=,RUN=0 -pattern PubmedArticle -TOTAL "[&TOTAL + #Author]"
+    -RUN "[if(Journal/ISSN == &PREV, &RUN + 1, 1)]" -PREV Journal/ISSN ...
+
+  Values set by one record are seen by the next. Records are processed one at
+  a time, in order, so -persist gives up the parallel speedup of multiple CPUs,
+  and cannot be combined with -trial.
+
 Numeric Processing
 
   -num             Count
@@ -199,6 +270,9 @@ Numeric Processing
   -sub             Difference
   -avg             Average
   -dev             Deviation
+  -med             Median
+  -pct             Percentile, e.g., -pattern INSDSet -pct 90 INSDSeq_length
+  -mode            Most frequent value
 
 String Processing
 
@@ -206,6 +280,13 @@ String Processing
   -upper           Convert text to upper-case
   -lower           Convert text to lower-case
   -title           Capitalize initial letters of words
+  -substr          Substring by position, e.g., 1:4 or -3:
+  -replace         Regular expression substitution, e.g., "/ +/ /"
+  -split           Split at delimiter, e.g., ";" or ";[2]" or ";[-1]"
+  -lpad            Pad on left to width, e.g., 8:0
+  -rpad            Pad on right to width
+  -trim            Remove given characters from both ends
+  -accession       Prefix, number, version, database, and type
 
 Phrase Processing
 
@@ -225,9 +306,127 @@ Sequence Coordinates
   -1-based         One-Based
   -ucsc-based      Half-Open
 
+ASN.1 Input
+
+  -asn             Convert ASN.1 value notation to NCBI-XML elements
+
+  Input starting with a "Type ::=" assignment is converted automatically.
+  Enumerated values are written only as value attributes.
+
+Coordinate Mappings
+
+  -coord           "Pattern:Element BASE start|stop|pos"
+  -coords          File of mappings, one per line
+
+  -coord "DocumentSummary:Start 1 start" -coord "Rs:@pos 0 pos"
+
+Lookup Tables
+
+  -lookup          Tab-delimited file of keys and values
+  -map             Values for element or &VARIABLE keys
+
+  The first column is the key. Other columns are printed by -map, separated
+  by tabs. Keys are matched exactly, and the first row for a key is kept.
+
+  -lookup clades.txt -pattern Taxon -if TaxId -in-lookup -element TaxId -map TaxId
+
+Interval Operations
+
+  -intervals       Range queries on chromosome, start, and stop columns
+    merge          Combine overlapping or adjacent intervals
+    overlap FILE   Pair each interval with overlapping FILE intervals
+    subtract FILE  Remove portions covered by FILE intervals
+    nearest FILE   Closest FILE intervals and distance
+
+  Positions are swapped if start is greater than stop. Additional columns
+  are carried along, e.g., from GenomicInfoType ChrLoc ChrStart ChrStop.
+
+Sequence Processing
+
+  -revcomp         Reverse complement of nucleotides
+  -translate       Translate nucleotides to protein
+  -subseq          Assemble INSDFeature sequence from intervals
+
+Sequence Statistics
+
+  -composition     Each residue and its count
+  -residues        Counts of listed residues, e.g., ACGT
+  -gc              Percent GC content
+  -molwt           Average molecular weight
+  -pi              Protein isoelectric point
+  -ambig           Count of ambiguous nucleotides
+  -codons          Codon counts for -codon-usage
+
+Translation Customization
+
+  -gcode           Genetic code table number
+  -frame           Reading frame, 1, 2, or 3
+
+  Within an INSDFeature, transl_table and codon_start qualifiers are used
+  unless overridden. The initiation codon becomes M on 5' complete features,
+  and the terminal stop is removed, matching the /translation qualifier.
+
+  -subseq INSDFeature and -translate INSDFeature join the feature intervals,
+  taking complement strands and single-base points into account.
+
+  -composition writes residue and count pairs, use -sep "\n" for nested lines.
+
+Open Reading Frames
+
+  -orf             Sequence element to scan in all six frames
+  -orf-min         Minimum length in residues [100]
+  -orf-code        Genetic code table number [1]
+  -orf-starts      Start codons, e.g., ATG,GTG,TTG [ATG]
+
+  ORF objects are inserted after the sequence element, and contain ORF_frame,
+  ORF_start, ORF_stop, ORF_length, and ORF_translation. Start is greater than
+  stop on the minus strand.
+
+  -orf INSDSeq_sequence -pattern INSDSeq -block ORF -if ORF_length -gt 300 ...
+
+Attribute Pivot
+
+  -pivot           Element@name, or Element@name|fallback
+
+  -pivot "Attribute@harmonized_name|attribute_name" -pattern BioSample
+    -element @accession
+
+  A header lists every distinct name. Each record is a row, with -element
+  columns followed by one column per name. Repeated names are joined by "|".
+
+Aggregation
+
+  -aggregate       Summary functions for output rows
+                     count, distinct:COL, sum:COL, min:COL, max:COL,
+                     mean:COL, stddev:COL, median:COL
+  -by              Key columns for grouping, e.g., 1,2
+
+  Each output line is a row. Groups are printed after all records, sorted by
+  key, with key columns followed by function results. Keys are not case-folded.
+
+  -by 1 -aggregate count,mean:2 -pattern PubmedArticle
+    -element Journal/ISOAbbreviation "#Author"
+
+Histogram
+
+  -histogram       Value column, and optional bins
+                     width (default 1), log, log2, year, month
+  -by              Column for separate series
+  -chart           Draw counts as SVG [bar|line]
+
+  Bins are labeled by lower bound. Empty bins between the lowest and highest
+  value are included unless that would exceed 1000 bins, in which case only
+  occupied bins are shown. Dates use their year, or YYYY-MM with month bins.
+
+  -histogram 1 5 -chart bar -pattern PubmedArticle
+    -block PubDate -element Year
+
 Command Generator
 
   -insd            Generate INSDSeq extraction commands
+  -xpath           Generate commands from XPath expressions
+  -codon-usage     Tabulate codons of CDS features
+  -taxonomy        Assemble Taxon records into a tree
 
 -insd Argument Order
 
@@ -235,6 +434,39 @@ Command Generator
   Flags            [complete|partial]
   Feature(s)       CDS,mRNA
   Qualifiers       INSDFeature_key "#INSDInterval" gene product
+  Computed         feat_sequence feat_translation
+
+-codon-usage Argument Order
+
+  Mode             [record|aggregate]
+  Extraction       [-pattern INSDSeq ... -codons INSDFeature]
+
+  Columns are codon, amino acid, count, frequency per thousand, and relative
+  synonymous codon usage. Complement intervals, codon_start, and transl_table
+  are honored. The first genetic code seen assigns amino acids.
+
+-taxonomy Argument Order
+
+  Mode             lineage|lca|newick
+  Sets             [9606,10090 7227,9606 | file of sets]
+  Extraction       [-pattern Taxon ...]
+
+  Lineage columns are taxid, name, superkingdom, kingdom, phylum, class,
+  order, family, genus, and species. Each lca set is printed with the taxid,
+  name, and rank of its lowest common ancestor, or of all records without sets.
+
+-xpath Argument Order
+
+  Record           "//PubmedArticle"
+  Columns          MedlineCitation/PMID "count(.//Author)" "//Author[1]/LastName"
+
+-xpath Subset
+
+  Axes             / // . .. @ text()
+  Predicates       [2] [last()] [@attr='value'] [Year > 2000] [not(Child)]
+  Tests            contains() starts-with() ends-with() and or
+  Functions        count() sum() string-length() concat() normalize-space()
+                   upper-case() lower-case()
 
 Miscellaneous
 
@@ -279,6 +511,10 @@ Notes
 
   -words, -pairs, and -indices convert to lower case.
 
+  -substr, -replace, -split, -lpad, -rpad, and -trim take a parameter before the element names.
+
+  -accession writes dashes for missing fields, and "invalid" database and type if malformed.
+
 Examples
 
   -pattern DocumentSummary -element Id -first Name Title
@@ -299,6 +535,8 @@ Examples
 
   -if "#Author" -lt 6 -and "%Title" -le 70
 
+  -block Author -element "..PubmedArticle/MedlineCitation/PMID" LastName ">/LastName"
+
   -if DateCreated/Year -gt 2005
 
   -if ChrStop -lt ChrStart
@@ -311,6 +549,8 @@ Examples
 
   -min ChrStart,ChrStop
 
+  -substr 1:4 PubDate/MedlineDate -replace "/[^0-9]//" Volume -lpad 8:0 PMID
+
   -max ExonCount
 
   -inc @aaPosition -element @residue
@@ -1729,6 +1969,11 @@ const (
 	PFC
 	RST
 	DEF
+	GCODE
+	FRAME
+	ORDER
+	DISTINCT
+	KEEP
 	POSITION
 	IF
 	UNLESS
@@ -1741,6 +1986,7 @@ const (
 	STARTSWITH
 	ENDSWITH
 	ISNOT
+	INLOOKUP
 	GT
 	GE
 	LT
@@ -1757,6 +2003,27 @@ const (
 	SUB
 	AVG
 	DEV
+	MED
+	PCT
+	MODE
+	SUBSTR
+	REPLACE
+	SPLIT
+	LPAD
+	RPAD
+	TRIM
+	REVCOMP
+	TRANSLATE
+	SUBSEQ
+	COMPOSITION
+	RESIDUES
+	GCCONTENT
+	MOLWT
+	ISOPOINT
+	AMBIGUOUS
+	CODONS
+	ACCESSION
+	LOOKUP
 	ZEROBASED
 	ONEBASED
 	UCSCBASED
@@ -1899,6 +2166,7 @@ var argTypeIs = map[string]ArgumentType{
 	"-starts-with": CONDITIONAL,
 	"-ends-with":   CONDITIONAL,
 	"-is-not":      CONDITIONAL,
+	"-in-lookup":   CONDITIONAL,
 	"-gt":          CONDITIONAL,
 	"-ge":          CONDITIONAL,
 	"-lt":          CONDITIONAL,
@@ -1927,6 +2195,27 @@ var argTypeIs = map[string]ArgumentType{
 	"-sub":         EXTRACTION,
 	"-avg":         EXTRACTION,
 	"-dev":         EXTRACTION,
+	"-med":         EXTRACTION,
+	"-pct":         EXTRACTION,
+	"-mode":        EXTRACTION,
+	"-substr":      EXTRACTION,
+	"-replace":     EXTRACTION,
+	"-split":       EXTRACTION,
+	"-lpad":        EXTRACTION,
+	"-rpad":        EXTRACTION,
+	"-trim":        EXTRACTION,
+	"-revcomp":     EXTRACTION,
+	"-translate":   EXTRACTION,
+	"-subseq":      EXTRACTION,
+	"-composition": EXTRACTION,
+	"-residues":    EXTRACTION,
+	"-gc":          EXTRACTION,
+	"-molwt":       EXTRACTION,
+	"-pi":          EXTRACTION,
+	"-ambig":       EXTRACTION,
+	"-codons":      EXTRACTION,
+	"-accession":   EXTRACTION,
+	"-map":         EXTRACTION,
 	"-0-based":     EXTRACTION,
 	"-zero-based":  EXTRACTION,
 	"-1-based":     EXTRACTION,
@@ -1947,6 +2236,11 @@ var argTypeIs = map[string]ArgumentType{
 	"-pfc":         CUSTOMIZATION,
 	"-rst":         CUSTOMIZATION,
 	"-def":         CUSTOMIZATION,
+	"-gcode":       CUSTOMIZATION,
+	"-frame":       CUSTOMIZATION,
+	"-order":       CUSTOMIZATION,
+	"-distinct":    CUSTOMIZATION,
+	"-keep":        CUSTOMIZATION,
 }
 
 var opTypeIs = map[string]OpType{
@@ -1972,6 +2266,11 @@ var opTypeIs = map[string]OpType{
 	"-pfc":         PFC,
 	"-rst":         RST,
 	"-def":         DEF,
+	"-gcode":       GCODE,
+	"-frame":       FRAME,
+	"-order":       ORDER,
+	"-distinct":    DISTINCT,
+	"-keep":        KEEP,
 	"-position":    POSITION,
 	"-if":          IF,
 	"-unless":      UNLESS,
@@ -1984,6 +2283,7 @@ var opTypeIs = map[string]OpType{
 	"-starts-with": STARTSWITH,
 	"-ends-with":   ENDSWITH,
 	"-is-not":      ISNOT,
+	"-in-lookup":   INLOOKUP,
 	"-gt":          GT,
 	"-ge":          GE,
 	"-lt":          LT,
@@ -2000,6 +2300,27 @@ var opTypeIs = map[string]OpType{
 	"-sub":         SUB,
 	"-avg":         AVG,
 	"-dev":         DEV,
+	"-med":         MED,
+	"-pct":         PCT,
+	"-mode":        MODE,
+	"-substr":      SUBSTR,
+	"-replace":     REPLACE,
+	"-split":       SPLIT,
+	"-lpad":        LPAD,
+	"-rpad":        RPAD,
+	"-trim":        TRIM,
+	"-revcomp":     REVCOMP,
+	"-translate":   TRANSLATE,
+	"-subseq":      SUBSEQ,
+	"-composition": COMPOSITION,
+	"-residues":    RESIDUES,
+	"-gc":          GCCONTENT,
+	"-molwt":       MOLWT,
+	"-pi":          ISOPOINT,
+	"-ambig":       AMBIGUOUS,
+	"-codons":      CODONS,
+	"-accession":   ACCESSION,
+	"-map":         LOOKUP,
 	"-0-based":     ZEROBASED,
 	"-zero-based":  ZEROBASED,
 	"-1-based":     ONEBASED,
@@ -2064,6 +2385,67 @@ var sequenceTypeIs = map[string]SequenceType{
 	"Rs:@structLoc":                   {0, ISPOS},
 }
 
+// AddSequenceType registers a "Pattern:Element BASE start|stop|pos" coordinate mapping for -0-based, -1-based, and -ucsc-based
+func AddSequenceType(spec string) {
+
+	flds := strings.Fields(spec)
+	if len(flds) != 3 || !strings.Contains(flds[0], ":") {
+		fmt.Fprintf(os.Stderr, "\nERROR: Coordinate mapping '%s' must be Pattern:Element BASE start|stop|pos\n", spec)
+		os.Exit(1)
+	}
+
+	based := 0
+	switch flds[1] {
+	case "0", "0-based":
+		based = 0
+	case "1", "1-based":
+		based = 1
+	default:
+		fmt.Fprintf(os.Stderr, "\nERROR: Coordinate base '%s' must be 0 or 1\n", flds[1])
+		os.Exit(1)
+	}
+
+	var which SeqEndType
+	switch strings.ToLower(flds[2]) {
+	case "start", "from":
+		which = ISSTART
+	case "stop", "end", "to":
+		which = ISSTOP
+	case "pos", "position":
+		which = ISPOS
+	default:
+		fmt.Fprintf(os.Stderr, "\nERROR: Coordinate type '%s' must be start, stop, or pos\n", flds[2])
+		os.Exit(1)
+	}
+
+	slock.Lock()
+	sequenceTypeIs[flds[0]] = SequenceType{based, which}
+	slock.Unlock()
+}
+
+// ReadSequenceTypes loads coordinate mappings from a file, one per line, with # comments
+func ReadSequenceTypes(fileName string) {
+
+	inFile, err := os.Open(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to open coordinate file '%s'\n", fileName)
+		os.Exit(1)
+	}
+	defer inFile.Close()
+
+	scanr := bufio.NewScanner(inFile)
+	for scanr.Scan() {
+		line := scanr.Text()
+		if pos := strings.Index(line, "#"); pos >= 0 {
+			line = line[:pos]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		AddSequenceType(line)
+	}
+}
+
 var plock sync.RWMutex
 
 var isStopWord = map[string]bool{
@@ -2259,6 +2641,19 @@ type Tables struct {
 	DoMixed   bool
 	DeAccent  bool
 	DoASCII   bool
+	OrfElem   string
+	OrfMin    int
+	OrfCode   int
+	OrfStarts []string
+	RecSkip   int
+	RecLimit  int
+	RecSample int
+	RecSeed   int64
+	RecDone   chan bool
+	UniqueKey *Block
+	PivotCmds *Block
+	Persist   []string
+	Persisted map[string]string
 }
 
 type Node struct {
@@ -2269,6 +2664,7 @@ type Node struct {
 	Attribs    []string
 	Children   *Node
 	Next       *Node
+	Up         *Node
 }
 
 type Step struct {
@@ -2278,11 +2674,14 @@ type Step struct {
 	Match  string
 	Attrib string
 	Wild   bool
+	Hops   []string
 }
 
 type Operation struct {
 	Type   OpType
 	Value  string
+	Arg    string
+	Expr   *Expression
 	Stages []*Step
 }
 
@@ -2767,6 +3166,28 @@ func SplitInTwoAt(str, chr string, side SideType) (string, string) {
 	return "", str
 }
 
+// SplitHops separates leading ancestor and sibling navigation steps from the rest of an element path
+func SplitHops(str string) ([]string, string) {
+
+	var hops []string
+
+	// "..", "..Name", ">", ">Name", "<", and "<Name" steps are each terminated by a slash
+	for strings.HasPrefix(str, "..") || strings.HasPrefix(str, ">") || strings.HasPrefix(str, "<") {
+		hop, rest := SplitInTwoAt(str, "/", LEFT)
+		if strings.Contains(hop, "@") && rest == "" {
+			// attribute of the relative itself, e.g., "..Article@PubModel"
+			hop, rest = SplitInTwoAt(hop, "@", LEFT)
+			rest = "@" + rest
+			hops = append(hops, hop)
+			return hops, rest
+		}
+		hops = append(hops, hop)
+		str = rest
+	}
+
+	return hops, str
+}
+
 func ConvertSlash(str string) string {
 
 	if str == "" {
@@ -3350,9 +3771,9 @@ func ParseArguments(args []string, pttrn string) *Block {
 			fmt.Fprintf(os.Stderr, "\nERROR: Cannot combine -position with -if or -unless commands\n")
 			os.Exit(1)
 		}
-		// check for missing argument after last condition
+		// check for missing argument after last condition, -in-lookup takes no value
 		txt = arguments[max-1]
-		if len(txt) > 0 && txt[0] == '-' {
+		if len(txt) > 0 && txt[0] == '-' && txt != "-in-lookup" {
 			fmt.Fprintf(os.Stderr, "\nERROR: Item missing after %s command\n", txt)
 			os.Exit(1)
 		}
@@ -3401,9 +3822,12 @@ func ParseArguments(args []string, pttrn string) *Block {
 				status = INDEX
 			}
 
+			// separate ancestor and sibling navigation steps
+			hops, path := SplitHops(str)
+
 			// parse parent/element@attribute construct
 			// colon indicates a namespace prefix in any or all of the components
-			prnt, match := SplitInTwoAt(str, "/", RIGHT)
+			prnt, match := SplitInTwoAt(path, "/", RIGHT)
 			match, attrib := SplitInTwoAt(match, "@", LEFT)
 			val := ""
 
@@ -3421,7 +3845,7 @@ func ParseArguments(args []string, pttrn string) *Block {
 				match, attrib = SplitInTwoAt(match, "@", LEFT)
 			}
 
-			tsk := &Step{Type: status, Value: str, Parent: prnt, Match: match, Attrib: attrib, Wild: wildcard}
+			tsk := &Step{Type: status, Value: str, Parent: prnt, Match: match, Attrib: attrib, Wild: wildcard, Hops: hops}
 
 			op.Stages = append(op.Stages, tsk)
 
@@ -3467,6 +3891,18 @@ func ParseArguments(args []string, pttrn string) *Block {
 			switch status {
 			case UNSET:
 				status = ParseFlag(str)
+				if status == INLOOKUP {
+					// lookup membership test takes no value
+					if op == nil {
+						fmt.Fprintf(os.Stderr, "\nERROR: Unexpected -in-lookup constraint\n")
+						os.Exit(1)
+					}
+					tsk := &Step{Type: status}
+					op.Stages = append(op.Stages, tsk)
+					op = nil
+					expectDash = true
+					status = UNSET
+				}
 			case POSITION:
 				cmds.Position = str
 				status = UNSET
@@ -3519,14 +3955,15 @@ func ParseArguments(args []string, pttrn string) *Block {
 							}
 							ch = str[0]
 						}
-						if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') {
-							prnt, match := SplitInTwoAt(str, "/", RIGHT)
+						if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || strings.HasPrefix(str, "..") || ch == '<' || ch == '>' {
+							hops, path := SplitHops(str)
+							prnt, match := SplitInTwoAt(path, "/", RIGHT)
 							match, attrib := SplitInTwoAt(match, "@", LEFT)
 							wildcard := false
 							if strings.HasPrefix(prnt, ":") || strings.HasPrefix(match, ":") || strings.HasPrefix(attrib, ":") {
 								wildcard = true
 							}
-							tsk := &Step{Type: status, Value: orig, Parent: prnt, Match: match, Attrib: attrib, Wild: wildcard}
+							tsk := &Step{Type: status, Value: orig, Parent: prnt, Match: match, Attrib: attrib, Wild: wildcard, Hops: hops}
 							op.Stages = append(op.Stages, tsk)
 						} else {
 							fmt.Fprintf(os.Stderr, "\nERROR: Unexpected numeric match constraints\n")
@@ -3581,6 +4018,9 @@ func ParseArguments(args []string, pttrn string) *Block {
 
 		status := UNSET
 
+		// -order, -distinct, or -keep in effect, cleared by -rst
+		arranged := false
+
 		// parse next argument
 		nextStatus := func(str string) OpType {
 
@@ -3591,13 +4031,26 @@ func ParseArguments(args []string, pttrn string) *Block {
 				op := &Operation{Type: status, Value: str[1:]}
 				comm = append(comm, op)
 				status = VALUE
-			case CLR, RST:
+			case CLR, RST, DISTINCT:
 				op := &Operation{Type: status, Value: ""}
 				comm = append(comm, op)
+				if status == DISTINCT {
+					arranged = true
+				} else if status == RST {
+					arranged = false
+				}
 				status = UNSET
-			case ELEMENT, FIRST, LAST, ENCODE, UPPER, LOWER, TITLE, TERMS, WORDS, PAIRS, LETTERS, INDICES:
-			case NUM, LEN, SUM, MIN, MAX, INC, DEC, SUB, AVG, DEV, ZEROBASED, ONEBASED, UCSCBASED:
-			case TAB, RET, PFX, SFX, SEP, LBL, PFC, DEF:
+			case INDICES:
+				if arranged {
+					// index lines are already sorted and unique, and are not separated values
+					fmt.Fprintf(os.Stderr, "\nERROR: -indices cannot follow -order, -distinct, or -keep without -rst\n")
+					os.Exit(1)
+				}
+			case ELEMENT, FIRST, LAST, ENCODE, UPPER, LOWER, TITLE, TERMS, WORDS, PAIRS, LETTERS:
+			case NUM, LEN, SUM, MIN, MAX, INC, DEC, SUB, AVG, DEV, MED, PCT, MODE, ZEROBASED, ONEBASED, UCSCBASED:
+			case SUBSTR, REPLACE, SPLIT, LPAD, RPAD, TRIM, REVCOMP, TRANSLATE, SUBSEQ,
+				COMPOSITION, RESIDUES, GCCONTENT, MOLWT, ISOPOINT, AMBIGUOUS, CODONS, ACCESSION, LOOKUP:
+			case TAB, RET, PFX, SFX, SEP, LBL, PFC, DEF, GCODE, FRAME, ORDER, KEEP:
 			case UNSET:
 				fmt.Fprintf(os.Stderr, "\nERROR: No -element before '%s'\n", str)
 				os.Exit(1)
@@ -3671,9 +4124,12 @@ func ParseArguments(args []string, pttrn string) *Block {
 					}
 				}
 
+				// separate ancestor and sibling navigation steps
+				hops, path := SplitHops(item)
+
 				// parse parent/element@attribute construct
 				// colon indicates a namespace prefix in any or all of the components
-				prnt, match := SplitInTwoAt(item, "/", RIGHT)
+				prnt, match := SplitInTwoAt(path, "/", RIGHT)
 				match, attrib := SplitInTwoAt(match, "@", LEFT)
 
 				// leading colon indicates namespace prefix wildcard
@@ -3727,7 +4183,7 @@ func ParseArguments(args []string, pttrn string) *Block {
 				default:
 				}
 
-				tsk := &Step{Type: status, Value: item, Parent: prnt, Match: match, Attrib: attrib, Wild: wildcard}
+				tsk := &Step{Type: status, Value: item, Parent: prnt, Match: match, Attrib: attrib, Wild: wildcard, Hops: hops}
 
 				op.Stages = append(op.Stages, tsk)
 			}
@@ -3749,10 +4205,38 @@ func ParseArguments(args []string, pttrn string) *Block {
 			case UNSET:
 				status = nextStatus(str)
 			case ELEMENT, FIRST, LAST, ENCODE, UPPER, LOWER, TITLE, TERMS, WORDS, PAIRS, LETTERS, INDICES,
-				NUM, LEN, SUM, MIN, MAX, INC, DEC, SUB, AVG, DEV, ZEROBASED, ONEBASED, UCSCBASED:
+				NUM, LEN, SUM, MIN, MAX, INC, DEC, SUB, AVG, DEV, MED, PCT, MODE, ZEROBASED, ONEBASED, UCSCBASED,
+				SUBSTR, REPLACE, SPLIT, LPAD, RPAD, TRIM, REVCOMP, TRANSLATE, SUBSEQ,
+				COMPOSITION, RESIDUES, GCCONTENT, MOLWT, ISOPOINT, AMBIGUOUS, CODONS, ACCESSION, LOOKUP:
+				arg := ""
+				hasArg := false
+				switch status {
+				case SUBSTR, REPLACE, SPLIT, LPAD, RPAD, TRIM, RESIDUES:
+					// first argument of string operation is its parameter, which may start with a minus sign
+					arg = str
+					hasArg = true
+					CheckStringParameter(status, arg)
+				case PCT:
+					// first argument of -pct is the percentile
+					arg = str
+					hasArg = true
+					if num, err := strconv.Atoi(arg); err != nil || num < 0 || num > 100 {
+						fmt.Fprintf(os.Stderr, "\nERROR: -pct parameter '%s' must be an integer from 0 to 100\n", arg)
+						os.Exit(1)
+					}
+				default:
+				}
+				if hasArg {
+					if idx >= max || strings.HasPrefix(arguments[idx], "-") {
+						fmt.Fprintf(os.Stderr, "\nERROR: Item missing after %s parameter\n", arg)
+						os.Exit(1)
+					}
+					str = arguments[idx]
+					idx++
+				}
 				for !strings.HasPrefix(str, "-") {
 					// create one operation per argument, even if under a single -element statement
-					op := &Operation{Type: status, Value: str}
+					op := &Operation{Type: status, Value: str, Arg: arg}
 					comm = append(comm, op)
 					parseSteps(op, pttrn)
 					if idx >= max {
@@ -3769,6 +4253,34 @@ func ParseArguments(args []string, pttrn string) *Block {
 				op := &Operation{Type: status, Value: ConvertSlash(str)}
 				comm = append(comm, op)
 				status = UNSET
+			case GCODE, FRAME:
+				num, err := strconv.Atoi(str)
+				if status == GCODE {
+					if _, ok := geneticCodeIs[num]; !ok || err != nil {
+						fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized genetic code '%s'\n", str)
+						os.Exit(1)
+					}
+				} else if err != nil || num < 1 || num > 3 {
+					fmt.Fprintf(os.Stderr, "\nERROR: Reading frame '%s' must be 1, 2, or 3\n", str)
+					os.Exit(1)
+				}
+				op := &Operation{Type: status, Value: str}
+				comm = append(comm, op)
+				status = UNSET
+			case ORDER, KEEP:
+				if status == ORDER {
+					if str != "asc" && str != "desc" && str != "num" && str != "num-desc" {
+						fmt.Fprintf(os.Stderr, "\nERROR: -order '%s' must be asc, desc, num, or num-desc\n", str)
+						os.Exit(1)
+					}
+				} else if num, err := strconv.Atoi(strings.Split(str, ":")[0]); err != nil || num < 1 {
+					fmt.Fprintf(os.Stderr, "\nERROR: -keep '%s' must be a positive number, optionally followed by :TEXT\n", str)
+					os.Exit(1)
+				}
+				op := &Operation{Type: status, Value: ConvertSlash(str)}
+				comm = append(comm, op)
+				arranged = true
+				status = UNSET
 			case VARIABLE:
 				op := &Operation{Type: status, Value: str[1:]}
 				comm = append(comm, op)
@@ -3776,7 +4288,17 @@ func ParseArguments(args []string, pttrn string) *Block {
 			case VALUE:
 				op := &Operation{Type: status, Value: str}
 				comm = append(comm, op)
-				parseSteps(op, pttrn)
+				length := len(str)
+				if length > 1 && str[0] == '[' && str[length-1] == ']' {
+					// compute variable from expression inside brackets, e.g., -LEN "[&STOP - &START + 1]"
+					op.Expr = ParseExpression(str[1:length-1], func(name string) *Operation {
+						elem := &Operation{Type: FIRST, Value: name}
+						parseSteps(elem, pttrn)
+						return elem
+					})
+				} else {
+					parseSteps(op, pttrn)
+				}
 				status = UNSET
 			case UNRECOGNIZED:
 				fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized argument '%s'\n", str)
@@ -6483,6 +7005,27 @@ func ProcessINSD(args []string, isPipe, addDash, doIndex bool) []string {
 			// report capitalization or vocabulary failure
 			checkAgainstVocabulary(str, "element", insdtags)
 
+		} else if str == "feat_sequence" || str == "feat_translation" {
+
+			// assemble feature sequence from intervals, optionally translating it
+			cmd := "-subseq"
+			if str == "feat_translation" {
+				cmd = "-translate"
+			}
+			if doIndex {
+				// sequences are not indexed
+				continue
+			}
+			acc = append(acc, "-block", "INSDFeature", cmd, "INSDFeature")
+			if addDash {
+				acc = append(acc, "-block", "INSDFeature", "-unless", "INSDFeature_intervals")
+				if isPipe {
+					acc = append(acc, "-lbl", "\\-")
+				} else {
+					acc = append(acc, "-lbl", "\"\\-\"")
+				}
+			}
+
 		} else {
 
 			acc = append(acc, "-block", "INSDQualifier")
@@ -6619,2267 +7162,8192 @@ func ProcessE2Index(args []string, isPipe bool) []string {
 	return acc
 }
 
-// COLLECT AND FORMAT REQUESTED XML VALUES
+// XPATH SUBSET COMMAND GENERATOR
 
-// ParseAttributes is only run if attribute values are requested in element statements
-func ParseAttributes(attrb string) []string {
+// XPathStep is one location step of an XPath expression
+type XPathStep struct {
+	Deep  bool
+	Name  string
+	Preds []string
+}
 
-	if attrb == "" {
-		return nil
-	}
+// SplitXPath separates an XPath location path into steps, keeping predicates with their steps
+func SplitXPath(str string) []XPathStep {
 
-	attlen := len(attrb)
+	var steps []XPathStep
 
-	// count equal signs
-	num := 0
-	for i := 0; i < attlen; i++ {
-		if attrb[i] == '=' {
-			num += 2
+	deep := false
+	depth := 0
+	quote := rune(0)
+	start := 0
+
+	addStep := func(txt string) {
+
+		if txt == "" {
+			return
+		}
+
+		// remove explicit axis names
+		if strings.HasPrefix(txt, "child::") {
+			txt = txt[7:]
+		} else if strings.HasPrefix(txt, "descendant::") {
+			txt = txt[12:]
+			deep = true
+		} else if strings.HasPrefix(txt, "attribute::") {
+			txt = "@" + txt[11:]
+		}
+
+		// predicates follow step name in square brackets
+		name, rest := SplitInTwoAt(txt, "[", LEFT)
+		stp := XPathStep{Deep: deep, Name: name}
+
+		for rest != "" {
+			lvl := 1
+			quo := rune(0)
+			pos := -1
+			for i, ch := range rest {
+				if quo != 0 {
+					if ch == quo {
+						quo = 0
+					}
+					continue
+				}
+				if ch == '\'' || ch == '"' {
+					quo = ch
+				} else if ch == '[' {
+					lvl++
+				} else if ch == ']' {
+					lvl--
+					if lvl == 0 {
+						pos = i
+						break
+					}
+				}
+			}
+			if pos < 0 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unbalanced brackets in XPath step '%s'\n", txt)
+				os.Exit(1)
+			}
+			stp.Preds = append(stp.Preds, strings.TrimSpace(rest[:pos]))
+			rest = strings.TrimPrefix(rest[pos+1:], "[")
 		}
+
+		steps = append(steps, stp)
+		deep = false
 	}
-	if num < 1 {
-		return nil
+
+	for i, ch := range str {
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"':
+			quote = ch
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				if i == start && i > 0 {
+					// double slash selects descendants
+					deep = true
+				} else {
+					addStep(str[start:i])
+				}
+				if i == 0 && strings.HasPrefix(str, "//") {
+					deep = true
+				}
+				start = i + 1
+			}
+		default:
+		}
 	}
 
-	// allocate array of proper size
-	arry := make([]string, num)
-	if arry == nil {
-		return nil
+	addStep(str[start:])
+
+	return steps
+}
+
+// LexXPath splits an XPath predicate or function argument list into tokens, string literals retain their leading quote
+func LexXPath(str string) []string {
+
+	var tokens []string
+
+	isNameChar := func(ch byte) bool {
+		return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '_' || ch == '-' || ch == '.' || ch == ':' || ch == '/' || ch == '@' || ch == '*'
 	}
 
-	start := 0
+	max := len(str)
 	idx := 0
-	itm := 0
 
-	// place tag and value in successive array slots
-	for idx < attlen && itm < num {
-		ch := attrb[idx]
-		if ch == '=' {
-			// skip past possible leading blanks
-			for start < attlen {
-				ch = attrb[start]
-				if ch == ' ' || ch == '\n' || ch == '\t' || ch == '\r' || ch == '\f' {
-					start++
-				} else {
-					break
-				}
+	for idx < max {
+		ch := str[idx]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			idx++
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(str[idx+1:], ch)
+			if end < 0 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unterminated string in XPath expression '%s'\n", str)
+				os.Exit(1)
 			}
-			// =
-			arry[itm] = attrb[start:idx]
-			itm++
-			// skip past equal sign and leading double quote
-			idx += 2
-			start = idx
-		} else if ch == '"' {
-			// "
-			arry[itm] = attrb[start:idx]
-			itm++
-			// skip past trailing double quote and (possible) space
-			idx += 2
-			start = idx
-		} else {
+			tokens = append(tokens, "'"+str[idx+1:idx+1+end])
+			idx += end + 2
+		case ch == '!' || ch == '<' || ch == '>':
+			if idx+1 < max && str[idx+1] == '=' {
+				tokens = append(tokens, str[idx:idx+2])
+				idx += 2
+			} else {
+				tokens = append(tokens, str[idx:idx+1])
+				idx++
+			}
+		case ch == '=' || ch == '(' || ch == ')' || ch == ',':
+			tokens = append(tokens, str[idx:idx+1])
 			idx++
+		case isNameChar(ch):
+			start := idx
+			for idx < max && isNameChar(str[idx]) {
+				idx++
+			}
+			tokens = append(tokens, str[start:idx])
+		default:
+			fmt.Fprintf(os.Stderr, "\nERROR: Unexpected character '%c' in XPath expression '%s'\n", ch, str)
+			os.Exit(1)
 		}
 	}
 
-	return arry
+	return tokens
 }
 
-// ExploreElements returns matching element values to callback
-func ExploreElements(curr *Node, mask, prnt, match, attrib string, wildcard bool, level int, proc func(string, int)) {
+// XPathElement converts a relative XPath location path into an xtract element specifier
+func XPathElement(ctx, path string) string {
 
-	if curr == nil || proc == nil {
-		return
+	// text() selects the contents of the preceding step
+	path = strings.TrimSuffix(path, "/text()")
+	if path == "text()" {
+		path = "."
 	}
 
-	// **/Object performs deep exploration of recursive data (*/Object also supported)
-	deep := false
-	if prnt == "**" || prnt == "*" {
-		prnt = ""
-		deep = true
+	// parent axis maps directly onto enclosing object navigation
+	if strings.HasPrefix(path, "..") {
+		return path
 	}
 
-	// exploreElements recursive definition
-	var exploreElements func(curr *Node, skip string, lev int)
+	if path == "." || path == "" {
+		return ctx
+	}
 
-	exploreElements = func(curr *Node, skip string, lev int) {
-
-		if !deep && curr.Name == skip {
-			// do not explore within recursive object
-			return
-		}
-
-		// wildcard matches any namespace prefix
-		if curr.Name == match ||
-			(wildcard && strings.HasPrefix(match, ":") && strings.HasSuffix(curr.Name, match)) ||
-			(match == "" && attrib != "") {
-
-			if prnt == "" ||
-				curr.Parent == prnt ||
-				(wildcard && strings.HasPrefix(prnt, ":") && strings.HasSuffix(curr.Parent, prnt)) {
-
-				if attrib != "" {
-					if curr.Attributes != "" && curr.Attribs == nil {
-						// parse attributes on-the-fly if queried
-						curr.Attribs = ParseAttributes(curr.Attributes)
-					}
-					for i := 0; i < len(curr.Attribs)-1; i += 2 {
-						// attributes now parsed into array as [ tag, value, tag, value, tag, value, ... ]
-						if curr.Attribs[i] == attrib ||
-							(wildcard && strings.HasPrefix(attrib, ":") && strings.HasSuffix(curr.Attribs[i], attrib)) {
-							proc(curr.Attribs[i+1], level)
-							return
-						}
-					}
-
-				} else if curr.Contents != "" {
-
-					str := curr.Contents[:]
-
-					if HasAmpOrNotASCII(str) {
-						// processing of <, >, &, ", and ' characters is now delayed until element contents is requested
-						str = html.UnescapeString(str)
-					}
-
-					proc(str, level)
-					return
-
-				} else if curr.Children != nil {
+	if strings.HasPrefix(path, ".//") {
+		path = path[1:]
+	} else {
+		path = strings.TrimPrefix(path, "./")
+	}
 
-					// for XML container object, send empty string to callback to increment count
-					proc("", level)
-					// and continue exploring
+	steps := SplitXPath(path)
 
-				} else if curr.Attributes != "" {
+	attr := ""
+	if len(steps) > 0 && strings.HasPrefix(steps[len(steps)-1].Name, "@") {
+		attr = steps[len(steps)-1].Name
+		steps = steps[:len(steps)-1]
+	}
 
-					// for self-closing object, indicate presence by sending empty string to callback
-					proc("", level)
-					return
-				}
-			}
+	for _, stp := range steps {
+		if len(stp.Preds) > 0 {
+			fmt.Fprintf(os.Stderr, "\nERROR: Nested XPath predicates are not supported in '%s'\n", path)
+			os.Exit(1)
 		}
+	}
 
-		for chld := curr.Children; chld != nil; chld = chld.Next {
-			// inner exploration is subject to recursive object exclusion
-			exploreElements(chld, mask, lev+1)
+	if len(steps) < 1 || (len(steps) == 1 && steps[0].Name == ".") {
+		// attribute of context node
+		if ctx == "" || ctx == "*" {
+			return attr
 		}
+		return ctx + attr
 	}
 
-	exploreElements(curr, "", level)
-}
-
-// PrintSubtree supports compression styles selected by -element "*" through "****"
-func PrintSubtree(node *Node, style IndentType, printAttrs bool, proc func(string)) {
-
-	if node == nil || proc == nil {
-		return
+	last := steps[len(steps)-1]
+	if last.Name == "*" {
+		fmt.Fprintf(os.Stderr, "\nERROR: XPath wildcard cannot select element values in '%s'\n", path)
+		os.Exit(1)
 	}
 
-	// WRAPPED is SUBTREE plus each attribute on its own line
-	wrapped := false
-	if style == WRAPPED {
-		style = SUBTREE
-		wrapped = true
+	prev := ctx
+	if len(steps) > 1 {
+		prev = steps[len(steps)-2].Name
 	}
 
-	// INDENT is offset by two spaces to allow for parent tag, SUBTREE is not offset
-	initial := 1
-	if style == SUBTREE {
-		style = INDENT
-		initial = 0
+	if last.Deep || prev == "" || prev == "*" || prev == "." {
+		return last.Name + attr
 	}
 
-	// array to speed up indentation
-	indentSpaces := []string{
-		"",
-		"  ",
-		"    ",
-		"      ",
-		"        ",
-		"          ",
-		"            ",
-		"              ",
-		"                ",
-		"                  ",
-	}
+	return prev + "/" + last.Name + attr
+}
 
-	// indent a specified number of spaces
-	doIndent := func(indt int) {
-		i := indt
-		for i > 9 {
-			proc("                    ")
-			i -= 10
-		}
-		if i < 0 {
-			return
-		}
-		proc(indentSpaces[i])
-	}
+// ProcessXPath generates extraction commands from a record path followed by one XPath expression per column
+func ProcessXPath(args []string, isPipe bool) []string {
 
-	// doSubtree recursive definition
-	var doSubtree func(*Node, int)
+	var acc []string
 
-	doSubtree = func(curr *Node, depth int) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "\nERROR: Insufficient command-line arguments supplied to xtract -xpath\n")
+		os.Exit(1)
+	}
 
-		// suppress if it would be an empty self-closing tag
-		if !IsNotJustWhitespace(curr.Attributes) && curr.Contents == "" && curr.Children == nil {
-			return
+	// quote arguments when printing generated command
+	quote := func(str string) string {
+		if isPipe || strings.HasPrefix(str, "-") {
+			return str
 		}
+		return "\"" + str + "\""
+	}
 
-		if style == INDENT {
-			doIndent(depth)
-		}
+	isNumber := func(str string) bool {
+		_, err := strconv.ParseFloat(str, 64)
+		return err == nil
+	}
 
-		proc("<")
-		proc(curr.Name)
+	// compilePredicate converts one bracketed XPath predicate into conditional arguments or a position
+	compilePredicate := func(ctx, pred string) ([]string, string) {
 
-		if printAttrs {
+		var cond []string
 
-			attr := strings.TrimSpace(curr.Attributes)
-			attr = CompressRunsOfSpaces(attr)
+		tokens := LexXPath(pred)
 
-			if attr != "" {
+		// single numeric or last() predicate maps to -position
+		if len(tokens) == 1 && IsAllNumeric(tokens[0]) {
+			return nil, tokens[0]
+		}
+		if len(tokens) == 3 && tokens[0] == "last" && tokens[1] == "(" && tokens[2] == ")" {
+			return nil, "last"
+		}
+		if len(tokens) == 5 && tokens[0] == "position" && tokens[3] == "=" && IsAllNumeric(tokens[4]) {
+			return nil, tokens[4]
+		}
 
-				if wrapped {
+		max := len(tokens)
+		idx := 0
 
-					start := 0
-					idx := 0
+		next := func() string {
+			if idx >= max {
+				fmt.Fprintf(os.Stderr, "\nERROR: Incomplete XPath predicate '%s'\n", pred)
+				os.Exit(1)
+			}
+			tkn := tokens[idx]
+			idx++
+			return tkn
+		}
 
-					attlen := len(attr)
+		expect := func(str string) {
+			if next() != str {
+				fmt.Fprintf(os.Stderr, "\nERROR: Expected '%s' in XPath predicate '%s'\n", str, pred)
+				os.Exit(1)
+			}
+		}
 
-					for idx < attlen {
-						ch := attr[idx]
-						if ch == '=' {
-							str := attr[start:idx]
-							proc("\n")
-							doIndent(depth)
-							proc(" ")
-							proc(str)
-							// skip past equal sign and leading double quote
-							idx += 2
-							start = idx
-						} else if ch == '"' {
-							str := attr[start:idx]
-							proc("=\"")
-							proc(str)
-							proc("\"")
-							// skip past trailing double quote and (possible) space
-							idx += 2
-							start = idx
-						} else {
-							idx++
-						}
-					}
+		// constraint maps comparison operator and value onto string or numeric constraint
+		constraint := func(op, val string) []string {
+			lit := strings.HasPrefix(val, "'")
+			if lit {
+				val = val[1:]
+			} else if !isNumber(val) {
+				// numeric comparison against another element
+				val = XPathElement(ctx, val)
+			}
+			if strings.HasPrefix(val, "-") {
+				val = "\\" + val
+			}
+			if lit {
+				switch op {
+				case "=":
+					return []string{"-equals", val}
+				case "!=":
+					return []string{"-is-not", val}
+				default:
+				}
+				fmt.Fprintf(os.Stderr, "\nERROR: Unsupported string comparison '%s' in XPath predicate '%s'\n", op, pred)
+				os.Exit(1)
+			}
+			switch op {
+			case "=":
+				return []string{"-eq", val}
+			case "!=":
+				return []string{"-ne", val}
+			case "<":
+				return []string{"-lt", val}
+			case "<=":
+				return []string{"-le", val}
+			case ">":
+				return []string{"-gt", val}
+			case ">=":
+				return []string{"-ge", val}
+			default:
+			}
+			fmt.Fprintf(os.Stderr, "\nERROR: Unsupported operator '%s' in XPath predicate '%s'\n", op, pred)
+			os.Exit(1)
+			return nil
+		}
 
-					proc("\n")
-					doIndent(depth)
+		isOperator := func(str string) bool {
+			switch str {
+			case "=", "!=", "<", "<=", ">", ">=":
+				return true
+			default:
+			}
+			return false
+		}
 
+		// clause returns element and constraint arguments for one comparison
+		clause := func() []string {
+			tkn := next()
+			switch tkn {
+			case "contains", "starts-with", "ends-with":
+				expect("(")
+				elem := XPathElement(ctx, next())
+				expect(",")
+				val := next()
+				expect(")")
+				if !strings.HasPrefix(val, "'") {
+					fmt.Fprintf(os.Stderr, "\nERROR: Expected string literal in XPath predicate '%s'\n", pred)
+					os.Exit(1)
+				}
+				return []string{elem, "-" + tkn, val[1:]}
+			case "count", "string-length":
+				expect("(")
+				elem := XPathElement(ctx, next())
+				expect(")")
+				if tkn == "count" {
+					elem = "#" + elem
 				} else {
-
-					proc(" ")
-					proc(attr)
+					elem = "%" + elem
 				}
+				if idx < max && isOperator(tokens[idx]) {
+					op := next()
+					return append([]string{elem}, constraint(op, next())...)
+				}
+				return []string{elem}
+			case "text":
+				expect("(")
+				expect(")")
+				tkn = "."
+			default:
 			}
-		}
-
-		// see if suitable for for self-closing tag
-		if curr.Contents == "" && curr.Children == nil {
-			proc("/>")
-			if style != COMPACT {
-				proc("\n")
+			if strings.HasPrefix(tkn, "'") || isOperator(tkn) || tkn == "(" || tkn == ")" || tkn == "," {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unsupported XPath predicate '%s'\n", pred)
+				os.Exit(1)
 			}
-			return
+			elem := XPathElement(ctx, tkn)
+			if idx < max && isOperator(tokens[idx]) {
+				op := next()
+				return append([]string{elem}, constraint(op, next())...)
+			}
+			return []string{elem}
 		}
 
-		proc(">")
+		conj := ""
 
-		if curr.Contents != "" {
+		for idx < max {
+			cmd := "-if"
+			switch conj {
+			case "and":
+				cmd = "-and"
+			case "or":
+				cmd = "-or"
+			default:
+			}
+			if tokens[idx] == "not" {
+				if conj != "" {
+					fmt.Fprintf(os.Stderr, "\nERROR: not() must be the only test in XPath predicate '%s'\n", pred)
+					os.Exit(1)
+				}
+				idx++
+				expect("(")
+				cond = append(cond, "-unless")
+				cond = append(cond, clause()...)
+				expect(")")
+				if idx < max {
+					fmt.Fprintf(os.Stderr, "\nERROR: not() must be the only test in XPath predicate '%s'\n", pred)
+					os.Exit(1)
+				}
+				break
+			}
+			cond = append(cond, cmd)
+			cond = append(cond, clause()...)
+			if idx < max {
+				tkn := next()
+				if tkn != "and" && tkn != "or" {
+					fmt.Fprintf(os.Stderr, "\nERROR: Unexpected '%s' in XPath predicate '%s'\n", tkn, pred)
+					os.Exit(1)
+				}
+				if conj != "" && conj != tkn {
+					fmt.Fprintf(os.Stderr, "\nERROR: Cannot mix 'and' with 'or' in XPath predicate '%s'\n", pred)
+					os.Exit(1)
+				}
+				conj = tkn
+			}
+		}
 
-			proc(curr.Contents[:])
+		return cond, ""
+	}
 
-		} else {
+	// compilePredicates combines all predicates on one step
+	compilePredicates := func(ctx string, preds []string) []string {
 
-			if style != COMPACT {
-				proc("\n")
-			}
+		var cond []string
+		position := ""
 
-			for chld := curr.Children; chld != nil; chld = chld.Next {
-				doSubtree(chld, depth+1)
+		for _, pred := range preds {
+			res, pos := compilePredicate(ctx, pred)
+			if pos != "" {
+				position = pos
+				continue
 			}
-
-			if style == INDENT {
-				i := depth
-				for i > 9 {
-					proc("                    ")
-					i -= 10
+			if len(cond) > 0 {
+				if res[0] != "-if" {
+					fmt.Fprintf(os.Stderr, "\nERROR: Unable to combine XPath predicate '%s'\n", pred)
+					os.Exit(1)
 				}
-				proc(indentSpaces[i])
+				res[0] = "-and"
 			}
+			cond = append(cond, res...)
 		}
 
-		proc("<")
-		proc("/")
-		proc(curr.Name)
-		proc(">")
-
-		if style != COMPACT {
-			proc("\n")
+		if position != "" {
+			if len(cond) > 0 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Cannot combine XPath position and value predicates\n")
+				os.Exit(1)
+			}
+			return []string{"-position", position}
 		}
+
+		return cond
 	}
 
-	doSubtree(node, initial)
-}
+	// RECORD PATH
 
-// ProcessClause handles comma-separated -element arguments
-func ProcessClause(curr *Node, stages []*Step, mask, prev, pfx, sfx, sep, def string, status OpType, index, level int, variables map[string]string) (string, bool) {
+	steps := SplitXPath(args[0])
+	if len(steps) < 1 {
+		fmt.Fprintf(os.Stderr, "\nERROR: Missing XPath record path\n")
+		os.Exit(1)
+	}
 
-	if curr == nil || stages == nil {
-		return "", false
+	record := steps[len(steps)-1]
+	recName := record.Name
+	patrn := recName
+	if recName == "*" {
+		if len(steps) < 2 {
+			fmt.Fprintf(os.Stderr, "\nERROR: XPath record wildcard requires parent element\n")
+			os.Exit(1)
+		}
+		patrn = steps[len(steps)-2].Name + "/*"
 	}
 
-	// processElement handles individual -element constructs
-	processElement := func(acc func(string)) {
+	acc = append(acc, "-pattern", quote(patrn))
+	cond := compilePredicates(recName, record.Preds)
+	if len(cond) > 0 && cond[0] == "-position" {
+		fmt.Fprintf(os.Stderr, "\nERROR: XPath position predicate is not supported on record path\n")
+		os.Exit(1)
+	}
+	for _, str := range cond {
+		acc = append(acc, quote(str))
+	}
 
-		if acc == nil {
-			return
+	// exploration levels available below -division
+	levels := []string{"-group", "-branch", "-block", "-section", "-subset", "-unit"}
+
+	// compilePath generates exploration levels and final extraction argument for one location path
+	compilePath := func(path, cmd, pfx string, clear bool) {
+
+		path = strings.TrimSpace(path)
+		path = strings.TrimSuffix(path, "/text()")
+
+		steps := SplitXPath(path)
+
+		if strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") {
+			// absolute path must start at record
+			if len(steps) < 1 || (steps[0].Name != recName && recName != "*") {
+				fmt.Fprintf(os.Stderr, "\nERROR: Absolute XPath '%s' does not start at record '%s'\n", path, recName)
+				os.Exit(1)
+			}
+			steps = steps[1:]
+		} else if len(steps) > 0 && steps[0].Name == "." {
+			// relative to record, single slash selects children, double slash selects descendants
+			if len(steps) > 1 && len(steps[0].Preds) == 0 {
+				steps = steps[1:]
+			}
 		}
 
-		// element names combined with commas are treated as a prefix-separator-suffix group
-		for _, stage := range stages {
+		attr := ""
+		if len(steps) > 0 && strings.HasPrefix(steps[len(steps)-1].Name, "@") {
+			attr = steps[len(steps)-1].Name
+			steps = steps[:len(steps)-1]
+		}
 
-			stat := stage.Type
-			item := stage.Value
-			prnt := stage.Parent
-			match := stage.Match
-			attrib := stage.Attrib
-			wildcard := stage.Wild
+		acc = append(acc, "-division", quote(recName))
+		if clear {
+			acc = append(acc, "-clr")
+		}
 
-			// exploreElements is a wrapper for ExploreElements, obtaining most arguments as closures
-			exploreElements := func(proc func(string, int)) {
-				ExploreElements(curr, mask, prnt, match, attrib, wildcard, level, proc)
+		// each step with a following step, or with predicates, becomes an exploration level
+		ctx := recName
+		last := len(steps) - 1
+		lvl := 0
+		for i, stp := range steps {
+			if i == last && len(stp.Preds) == 0 {
+				break
+			}
+			if stp.Name == "." {
+				ctx = recName
+				continue
+			}
+			if lvl >= len(levels) {
+				fmt.Fprintf(os.Stderr, "\nERROR: XPath '%s' is too deeply nested\n", path)
+				os.Exit(1)
+			}
+			visit := stp.Name
+			if stp.Deep {
+				visit = "**/" + stp.Name
+			} else if ctx != "*" && ctx != "" {
+				visit = ctx + "/" + stp.Name
+			} else if stp.Name == "*" {
+				fmt.Fprintf(os.Stderr, "\nERROR: XPath wildcard requires named parent in '%s'\n", path)
+				os.Exit(1)
 			}
+			acc = append(acc, levels[lvl], quote(visit))
+			for _, str := range compilePredicates(stp.Name, stp.Preds) {
+				acc = append(acc, quote(str))
+			}
+			lvl++
+			ctx = stp.Name
+		}
 
-			switch stat {
-			case ELEMENT, TERMS, WORDS, PAIRS, LETTERS, INDICES, VALUE, LEN, SUM, MIN, MAX, SUB, AVG, DEV:
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						acc(str)
-					}
-				})
-			case FIRST:
-				single := ""
+		elem := ""
+		if last >= 0 && len(steps[last].Preds) == 0 && steps[last].Name != "." {
+			stp := steps[last]
+			if stp.Deep {
+				elem = stp.Name + attr
+			} else {
+				elem = XPathElement(ctx, stp.Name+attr)
+			}
+		} else {
+			elem = XPathElement(ctx, attr)
+		}
 
-				exploreElements(func(str string, lvl int) {
-					if single == "" {
-						single = str
-					}
-				})
+		acc = append(acc, cmd, quote(pfx+elem))
+	}
 
-				if single != "" {
-					acc(single)
-				}
-			case LAST:
-				single := ""
+	// compileColumn handles functions, string literals, and location paths
+	var compileColumn func(expr string, clear bool)
 
-				exploreElements(func(str string, lvl int) {
-					single = str
-				})
+	compileColumn = func(expr string, clear bool) {
 
-				if single != "" {
-					acc(single)
+		expr = strings.TrimSpace(expr)
+
+		if strings.HasPrefix(expr, "'") || strings.HasPrefix(expr, "\"") {
+			// string literal
+			acc = append(acc, "-division", quote(recName))
+			if clear {
+				acc = append(acc, "-clr")
+			}
+			acc = append(acc, "-lbl", quote(expr[1:len(expr)-1]))
+			return
+		}
+
+		fnc, arg := SplitInTwoAt(expr, "(", LEFT)
+		if arg == "" || !strings.HasSuffix(arg, ")") || strings.ContainsAny(fnc, "/[@") {
+			compilePath(expr, "-element", "", clear)
+			return
+		}
+		arg = strings.TrimSuffix(arg, ")")
+
+		switch fnc {
+		case "count", "sum", "string-length":
+			// aggregate functions operate on all matching elements at record level
+			steps := SplitXPath(arg)
+			for _, stp := range steps {
+				if len(stp.Preds) > 0 {
+					fmt.Fprintf(os.Stderr, "\nERROR: Predicates not supported inside XPath %s()\n", fnc)
+					os.Exit(1)
 				}
-			case ENCODE:
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						str = html.EscapeString(str)
-						acc(str)
-					}
-				})
-			case UPPER:
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						str = strings.ToUpper(str)
-						acc(str)
-					}
-				})
-			case LOWER:
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						str = strings.ToLower(str)
-						acc(str)
+			}
+			elem := XPathElement(recName, arg)
+			acc = append(acc, "-division", quote(recName))
+			if clear {
+				acc = append(acc, "-clr")
+			}
+			switch fnc {
+			case "count":
+				acc = append(acc, "-element", quote("#"+elem))
+			case "sum":
+				acc = append(acc, "-sum", quote(elem))
+			case "string-length":
+				acc = append(acc, "-element", quote("%"+elem))
+			default:
+			}
+		case "string", "normalize-space":
+			compilePath(arg, "-element", "", clear)
+		case "upper-case":
+			compilePath(arg, "-upper", "", clear)
+		case "lower-case":
+			compilePath(arg, "-lower", "", clear)
+		case "concat":
+			// split arguments at top-level commas, then clear tab between pieces
+			var parts []string
+			depth := 0
+			quo := rune(0)
+			start := 0
+			for i, ch := range arg {
+				if quo != 0 {
+					if ch == quo {
+						quo = 0
 					}
-				})
-			case TITLE:
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						str = strings.ToLower(str)
-						str = strings.Title(str)
-						acc(str)
+					continue
+				}
+				switch ch {
+				case '\'', '"':
+					quo = ch
+				case '(', '[':
+					depth++
+				case ')', ']':
+					depth--
+				case ',':
+					if depth == 0 {
+						parts = append(parts, arg[start:i])
+						start = i + 1
 					}
-				})
-			case VARIABLE:
-				// use value of stored variable
-				val, ok := variables[match]
-				if ok {
-					acc(val)
+				default:
 				}
-			case NUM, COUNT:
-				count := 0
+			}
+			parts = append(parts, arg[start:])
+			for i, part := range parts {
+				compileColumn(part, clear || i > 0)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "\nERROR: Unsupported XPath function '%s'\n", fnc)
+			os.Exit(1)
+		}
+	}
 
-				exploreElements(func(str string, lvl int) {
-					count++
-				})
+	// COLUMN EXPRESSIONS
 
-				// number of element objects
-				val := strconv.Itoa(count)
-				acc(val)
-			case LENGTH:
-				length := 0
+	for _, expr := range args[1:] {
+		if strings.Contains(expr, "|") {
+			fmt.Fprintf(os.Stderr, "\nERROR: XPath union '%s' is not supported, use separate columns\n", expr)
+			os.Exit(1)
+		}
+		compileColumn(expr, false)
+	}
 
-				exploreElements(func(str string, lvl int) {
-					length += len(str)
-				})
+	return acc
+}
 
-				// length of element strings
-				val := strconv.Itoa(length)
-				acc(val)
-			case DEPTH:
-				exploreElements(func(str string, lvl int) {
-					// depth of each element in scope
-					val := strconv.Itoa(lvl)
-					acc(val)
-				})
-			case INDEX:
-				// -element "+" prints index of current XML object
-				val := strconv.Itoa(index)
-				acc(val)
-			case INC:
-				// -inc, or component of -0-based, -1-based, or -ucsc-based
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						num, err := strconv.Atoi(str)
-						if err == nil {
-							// increment value
-							num++
-							val := strconv.Itoa(num)
-							acc(val)
-						}
-					}
-				})
-			case DEC:
-				// -dec, or component of -0-based, -1-based, or -ucsc-based
-				exploreElements(func(str string, lvl int) {
-					if str != "" {
-						num, err := strconv.Atoi(str)
-						if err == nil {
-							// decrement value
-							num--
-							val := strconv.Itoa(num)
-							acc(val)
-						}
-					}
-				})
-			case STAR:
-				// -element "*" prints current XML subtree on a single line
-				style := SINGULARITY
-				printAttrs := true
+// ARGUMENT SCRIPT FILES
 
-				for _, ch := range item {
-					if ch == '*' {
-						style++
-					} else if ch == '@' {
-						printAttrs = false
-					}
-				}
-				if style > WRAPPED {
-					style = WRAPPED
-				}
-				if style < COMPACT {
-					style = COMPACT
-				}
+// ReadScript splits an argument file into words, following shell quoting rules, and removing comments
+func ReadScript(fileName string) []string {
 
-				var buffer bytes.Buffer
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to read script file '%s'\n", fileName)
+		os.Exit(1)
+	}
 
-				PrintSubtree(curr, style, printAttrs,
-					func(str string) {
-						if str != "" {
-							buffer.WriteString(str)
-						}
-					})
+	var words []string
 
-				txt := buffer.String()
-				if txt != "" {
-					acc(txt)
-				}
-			case DOLLAR:
-				for chld := curr.Children; chld != nil; chld = chld.Next {
-					acc(chld.Name)
-				}
-			case ATSIGN:
-				if curr.Attributes != "" && curr.Attribs == nil {
-					curr.Attribs = ParseAttributes(curr.Attributes)
+	text := []rune(string(data))
+	max := len(text)
+
+	var buffer bytes.Buffer
+	inWord := false
+
+	endWord := func() {
+		if inWord {
+			words = append(words, buffer.String())
+			buffer.Reset()
+			inWord = false
+		}
+	}
+
+	for idx := 0; idx < max; idx++ {
+		ch := text[idx]
+
+		switch ch {
+		case ' ', '\t', '\n', '\r':
+			endWord()
+		case '#':
+			// pound sign at start of word followed by space, end of line, or another pound sign begins comment, "#Author" does not
+			nxt := ' '
+			if idx+1 < max {
+				nxt = text[idx+1]
+			}
+			if !inWord && (nxt == ' ' || nxt == '\t' || nxt == '\n' || nxt == '\r' || nxt == '#' || nxt == '!') {
+				for idx < max && text[idx] != '\n' {
+					idx++
 				}
-				for i := 0; i < len(curr.Attribs)-1; i += 2 {
-					acc(curr.Attribs[i])
+				continue
+			}
+			buffer.WriteRune(ch)
+			inWord = true
+		case '\\':
+			// backslash outside of quotes protects next character, backslash at end of line continues line
+			idx++
+			if idx+1 < max && text[idx] == '\r' && text[idx+1] == '\n' {
+				// ignore carriage return of Windows line ending
+				idx++
+			}
+			if idx < max && text[idx] != '\n' {
+				buffer.WriteRune(text[idx])
+				inWord = true
+			}
+		case '\'':
+			// single quotes preserve everything up to closing quote
+			inWord = true
+			idx++
+			for idx < max && text[idx] != '\'' {
+				buffer.WriteRune(text[idx])
+				idx++
+			}
+			if idx >= max {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unterminated single quote in script file '%s'\n", fileName)
+				os.Exit(1)
+			}
+		case '"':
+			// double quotes only interpret backslash before double quote or backslash, so "\n" reaches ConvertSlash intact
+			inWord = true
+			idx++
+			for idx < max && text[idx] != '"' {
+				if text[idx] == '\\' && idx+1 < max && (text[idx+1] == '"' || text[idx+1] == '\\') {
+					idx++
 				}
-			default:
+				buffer.WriteRune(text[idx])
+				idx++
+			}
+			if idx >= max {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unterminated double quote in script file '%s'\n", fileName)
+				os.Exit(1)
 			}
+		default:
+			buffer.WriteRune(ch)
+			inWord = true
 		}
 	}
 
-	ok := false
+	endWord()
 
-	// format results in buffer
-	var buffer bytes.Buffer
+	return words
+}
 
-	buffer.WriteString(prev)
-	buffer.WriteString(pfx)
-	between := ""
+// ExpandScripts replaces -script FILE arguments with file contents, processing -include, -define, and -use directives
+func ExpandScripts(args []string) []string {
 
-	switch status {
-	case ELEMENT, ENCODE, UPPER, LOWER, TITLE, VALUE, NUM, INC, DEC, ZEROBASED, ONEBASED, UCSCBASED:
-		processElement(func(str string) {
-			if str != "" {
-				ok = true
-				buffer.WriteString(between)
-				buffer.WriteString(str)
-				between = sep
-			}
-		})
-	case FIRST:
-		single := ""
+	found := false
+	for _, str := range args {
+		if str == "-script" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return args
+	}
 
-		processElement(func(str string) {
-			ok = true
-			if single == "" {
-				single = str
-			}
-		})
+	// named macros are shared by all script files, and can only be used after they are defined
+	macros := make(map[string][]string)
 
-		if single != "" {
-			buffer.WriteString(between)
-			buffer.WriteString(single)
-			between = sep
+	// expandWords recursive definition
+	var expandWords func(words []string, dir string, depth int) []string
+
+	// readFile obtains words from script file, resolving relative paths against including file
+	readFile := func(fileName, dir string, depth int) []string {
+
+		if depth > 16 {
+			fmt.Fprintf(os.Stderr, "\nERROR: Script files nested too deeply at '%s'\n", fileName)
+			os.Exit(1)
+		}
+		if dir != "" && !path.IsAbs(fileName) {
+			fileName = path.Join(dir, fileName)
 		}
-	case LAST:
-		single := ""
 
-		processElement(func(str string) {
-			ok = true
-			single = str
-		})
+		return expandWords(ReadScript(fileName), path.Dir(fileName), depth+1)
+	}
 
-		if single != "" {
-			buffer.WriteString(between)
-			buffer.WriteString(single)
-			between = sep
+	expandWords = func(words []string, dir string, depth int) []string {
+
+		var res []string
+
+		max := len(words)
+
+		// nextWord returns argument following a directive
+		nextWord := func(idx int, directive string) string {
+			if idx >= max {
+				fmt.Fprintf(os.Stderr, "\nERROR: Item missing after %s directive\n", directive)
+				os.Exit(1)
+			}
+			return words[idx]
 		}
-	case TERMS:
-		processElement(func(str string) {
-			if str != "" {
-				words := strings.Fields(str)
-				for _, item := range words {
-					max := len(item)
-					for max > 1 {
-						ch := item[max-1]
-						if ch != '.' && ch != ',' && ch != ':' && ch != ';' {
-							break
-						}
-						// trim trailing period, comma, colon, and semicolon
-						item = item[:max-1]
-						// continue checking for runs of punctuation at end
-						max--
+
+		for idx := 0; idx < max; idx++ {
+			str := words[idx]
+
+			switch str {
+			case "-script", "-include":
+				idx++
+				res = append(res, readFile(nextWord(idx, str), dir, depth)...)
+			case "-define":
+				idx++
+				name := nextWord(idx, str)
+				var body []string
+				for {
+					idx++
+					txt := nextWord(idx, "-define "+name)
+					if txt == "-end" {
+						break
 					}
-					ok = true
-					buffer.WriteString(between)
-					buffer.WriteString(item)
-					between = sep
-				}
-			}
-		})
-	case WORDS:
-		processElement(func(str string) {
-			if str != "" {
-				words := strings.FieldsFunc(str, func(c rune) bool {
-					return !unicode.IsLetter(c) && !unicode.IsDigit(c)
-				})
-				for _, item := range words {
-					item = strings.ToLower(item)
-					ok = true
-					buffer.WriteString(between)
-					buffer.WriteString(item)
-					between = sep
-				}
-			}
-		})
-	case PAIRS:
-		processElement(func(str string) {
-			if str != "" {
-				words := strings.FieldsFunc(str, func(c rune) bool {
-					return !unicode.IsLetter(c) && !unicode.IsDigit(c)
-				})
-				if len(words) > 1 {
-					past := ""
-					for _, item := range words {
-						item = strings.ToLower(item)
-						plock.RLock()
-						isSW := isStopWord[item]
-						plock.RUnlock()
-						if isSW {
-							past = ""
-							continue
-						}
-						if past != "" {
-							ok = true
-							buffer.WriteString(between)
-							buffer.WriteString(past + " " + item)
-							between = sep
-						}
-						past = item
+					if txt == "-define" {
+						fmt.Fprintf(os.Stderr, "\nERROR: Missing -end before nested -define in macro '%s'\n", name)
+						os.Exit(1)
 					}
+					body = append(body, txt)
 				}
-			}
-		})
-	case LETTERS:
-		processElement(func(str string) {
-			if str != "" {
-				for _, ch := range str {
-					ok = true
-					buffer.WriteString(between)
-					buffer.WriteRune(ch)
-					between = sep
+				macros[name] = body
+			case "-use":
+				idx++
+				name := nextWord(idx, str)
+				body, ok := macros[name]
+				if !ok {
+					fmt.Fprintf(os.Stderr, "\nERROR: Undefined macro '%s'\n", name)
+					os.Exit(1)
+				}
+				if depth > 16 {
+					fmt.Fprintf(os.Stderr, "\nERROR: Macro '%s' expanded too deeply\n", name)
+					os.Exit(1)
 				}
+				// macro body may use other macros
+				res = append(res, expandWords(body, dir, depth+1)...)
+			default:
+				res = append(res, str)
 			}
-		})
-	case INDICES:
-		var term []string
-		var pair []string
+		}
 
-		addToIndex := func(item, past string) string {
+		return res
+	}
 
-			if item == "" {
-				return ""
-			}
-			plock.RLock()
-			isSW := isStopWord[item]
-			plock.RUnlock()
-			if isSW {
-				// skip if stop word, interrupts overlapping word pair chain
-				return ""
-			}
-			ok = true
-			item = html.EscapeString(item)
-			// add single term
-			term = append(term, item)
-			if past != "" {
-				// add informative adjacent word pair
-				pair = append(pair, past+" "+item)
+	// command line arguments are not subject to -include, -define, or -use processing
+	var res []string
+
+	for idx := 0; idx < len(args); idx++ {
+		str := args[idx]
+		if str == "-script" {
+			idx++
+			if idx >= len(args) {
+				fmt.Fprintf(os.Stderr, "\nERROR: Item missing after -script command\n")
+				os.Exit(1)
 			}
+			res = append(res, readFile(args[idx], "", 0)...)
+			continue
+		}
+		res = append(res, str)
+	}
 
-			return item
+	return res
+}
+
+// STRING OPERATIONS
+
+var (
+	xlock   sync.RWMutex
+	regexIs = make(map[string]*regexp.Regexp)
+)
+
+// ParseRange converts a 1-based START:STOP substring parameter, negative positions count back from the end
+func ParseRange(arg string) (int, int, bool) {
+
+	lft, rgt := SplitInTwoAt(arg, ":", LEFT)
+	if !strings.Contains(arg, ":") {
+		return 0, 0, false
+	}
+
+	start := 1
+	stop := -1
+
+	if lft != "" {
+		num, err := strconv.Atoi(lft)
+		if err != nil || num == 0 {
+			return 0, 0, false
+		}
+		start = num
+	}
+	if rgt != "" {
+		num, err := strconv.Atoi(rgt)
+		if err != nil || num == 0 {
+			return 0, 0, false
 		}
+		stop = num
+	}
 
-		processElement(func(str string) {
-			if str != "" {
-				if IsNotASCII(str) {
-					str = DoAccentTransform(str)
-				}
-				str = strings.ToLower(str)
-				if HasBadSpace(str) {
-					str = CleanupBadSpaces(str)
-				}
-				if HasMarkup(str) {
-					str = RemoveUnicodeMarkup(str)
-				}
-				if HasAngleBracket(str) {
-					str = DoHTMLReplace(str)
-				}
+	return start, stop, true
+}
 
-				// break terms at spaces, allowing hyphenated terms
-				terms := strings.Fields(str)
-				for _, item := range terms {
-					item = html.UnescapeString(item)
-					// allow parentheses in chemical formula
-					item = TrimPunctuation(item)
-					// skip numbers
-					if IsAllNumeric(item) {
-						continue
-					}
-					// index single term
-					addToIndex(item, "")
-				}
+// SplitReplacement separates a sed-style /pattern/replacement/ parameter, any character can be the delimiter
+func SplitReplacement(arg string) (string, string, bool) {
 
-				// break words at non-alphanumeric punctuation
-				words := strings.FieldsFunc(str, func(c rune) bool {
-					return !unicode.IsLetter(c) && !unicode.IsDigit(c)
-				})
-				past := ""
-				for _, item := range words {
-					// skip anything starting with a digit
-					if len(item) < 1 || unicode.IsDigit(rune(item[0])) {
-						past = ""
-						continue
-					}
-					// index word and adjacent word pairs
-					past = addToIndex(item, past)
-				}
-			}
-		})
+	if len(arg) < 3 {
+		return "", "", false
+	}
 
-		if ok {
-			// sort arrays of words and pairs
-			sort.Slice(term, func(i, j int) bool { return term[i] < term[j] })
-			sort.Slice(pair, func(i, j int) bool { return pair[i] < pair[j] })
+	delim := arg[0:1]
+	parts := strings.Split(arg[1:], delim)
+	if len(parts) != 3 {
+		return "", "", false
+	}
 
-			last := ""
-			for _, item := range term {
-				if item == last {
-					// skip duplicate entry
-					continue
-				}
-				buffer.WriteString("      <NORM>")
-				buffer.WriteString(item)
-				buffer.WriteString("</NORM>\n")
-				last = item
+	pttrn := parts[0]
+	switch parts[2] {
+	case "":
+	case "i":
+		// trailing i requests case-insensitive matching
+		pttrn = "(?i)" + pttrn
+	default:
+		return "", "", false
+	}
+
+	return pttrn, parts[1], true
+}
+
+// SplitIndex separates a delimiter from an optional [N] field selection
+func SplitIndex(arg string) (string, int) {
+
+	if strings.HasSuffix(arg, "]") {
+		pos := strings.LastIndex(arg, "[")
+		if pos > 0 {
+			num, err := strconv.Atoi(arg[pos+1 : len(arg)-1])
+			if err == nil && num != 0 {
+				return ConvertSlash(arg[:pos]), num
 			}
+		}
+	}
 
-			last = ""
-			for _, item := range pair {
-				if item == last {
-					// skip duplicate entry
-					continue
+	return ConvertSlash(arg), 0
+}
+
+// CheckStringParameter confirms the parameter of a string operation, and compiles any regular expression
+func CheckStringParameter(status OpType, arg string) {
+
+	switch status {
+	case SUBSTR:
+		if _, _, ok := ParseRange(arg); !ok {
+			fmt.Fprintf(os.Stderr, "\nERROR: -substr parameter '%s' must be START:STOP\n", arg)
+			os.Exit(1)
+		}
+	case REPLACE:
+		pttrn, _, ok := SplitReplacement(arg)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "\nERROR: -replace parameter '%s' must be /PATTERN/REPLACEMENT/\n", arg)
+			os.Exit(1)
+		}
+		re, err := regexp.Compile(pttrn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to compile -replace pattern '%s'\n", pttrn)
+			os.Exit(1)
+		}
+		xlock.Lock()
+		regexIs[pttrn] = re
+		xlock.Unlock()
+	case SPLIT:
+		if delim, _ := SplitIndex(arg); delim == "" {
+			fmt.Fprintf(os.Stderr, "\nERROR: -split parameter '%s' must contain a delimiter\n", arg)
+			os.Exit(1)
+		}
+	case RESIDUES:
+		if arg == "" || strings.HasPrefix(arg, "-") {
+			fmt.Fprintf(os.Stderr, "\nERROR: -residues parameter '%s' must list residue letters\n", arg)
+			os.Exit(1)
+		}
+	case LPAD, RPAD:
+		wid, chr := SplitInTwoAt(arg, ":", LEFT)
+		num, err := strconv.Atoi(wid)
+		if err != nil || num < 1 || len([]rune(chr)) > 1 {
+			fmt.Fprintf(os.Stderr, "\nERROR: Padding parameter '%s' must be WIDTH or WIDTH:CHARACTER\n", arg)
+			os.Exit(1)
+		}
+	default:
+	}
+}
+
+// DoStringOperation applies -substr, -replace, -split, -lpad, -rpad, or -trim to a value
+func DoStringOperation(str, arg string, status OpType) []string {
+
+	switch status {
+	case SUBSTR:
+		start, stop, _ := ParseRange(arg)
+		runes := []rune(str)
+		max := len(runes)
+		// convert negative positions to positions from the end
+		if start < 0 {
+			start += max + 1
+		}
+		if stop < 0 {
+			stop += max + 1
+		}
+		if start < 1 {
+			start = 1
+		}
+		if stop > max {
+			stop = max
+		}
+		if start > stop {
+			return nil
+		}
+		return []string{string(runes[start-1 : stop])}
+	case REPLACE:
+		pttrn, repl, _ := SplitReplacement(arg)
+		xlock.RLock()
+		re := regexIs[pttrn]
+		xlock.RUnlock()
+		if re == nil {
+			return []string{str}
+		}
+		return []string{re.ReplaceAllString(str, repl)}
+	case SPLIT:
+		delim, num := SplitIndex(arg)
+		parts := strings.Split(str, delim)
+		if num == 0 {
+			return parts
+		}
+		// negative index counts back from the last field
+		if num < 0 {
+			num += len(parts) + 1
+		}
+		if num < 1 || num > len(parts) {
+			return nil
+		}
+		return []string{parts[num-1]}
+	case LPAD, RPAD:
+		wid, chr := SplitInTwoAt(arg, ":", LEFT)
+		num, _ := strconv.Atoi(wid)
+		if chr == "" {
+			chr = " "
+		}
+		diff := num - len([]rune(str))
+		if diff < 1 {
+			return []string{str}
+		}
+		pad := strings.Repeat(chr, diff)
+		if status == LPAD {
+			return []string{pad + str}
+		}
+		return []string{str + pad}
+	case TRIM:
+		return []string{strings.Trim(str, ConvertSlash(arg))}
+	default:
+	}
+
+	return []string{str}
+}
+
+// SEQUENCE OPERATIONS
+
+type GeneticCode struct {
+	Residues string
+	Starts   string
+}
+
+// geneticCodeIs holds NCBI translation tables, codons are ordered TTT, TTC, TTA, TTG, TCT, ... GGG
+var geneticCodeIs = map[int]GeneticCode{
+	1:  {"FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------**--*----M---------------M----------------------------"},
+	2:  {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSS**VVVVAAAADDEEGGGG", "----------**--------------------MMMM----------**---M------------"},
+	3:  {"FFLLSSSSYY**CCWWTTTTPPPPHHQQRRRRIIMMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**----------------------MM----------------------------"},
+	4:  {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--MM------**-------M------------MMMM---------------M------------"},
+	5:  {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSSSVVVVAAAADDEEGGGG", "---M------**--------------------MMMM---------------M------------"},
+	6:  {"FFLLSSSSYYQQCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	9:  {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG", "----------**-----------------------M---------------M------------"},
+	10: {"FFLLSSSSYY**CCCWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**-----------------------M----------------------------"},
+	11: {"FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------**--*----M------------MMMM---------------M------------"},
+	12: {"FFLLSSSSYY**CC*WLLLSPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**--*----M---------------M----------------------------"},
+	13: {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSGGVVVVAAAADDEEGGGG", "---M------**----------------------MM---------------M------------"},
+	14: {"FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG", "-----------*-----------------------M----------------------------"},
+	16: {"FFLLSSSSYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------*---*--------------------M----------------------------"},
+	21: {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNNKSSSSVVVVAAAADDEEGGGG", "----------**-----------------------M---------------M------------"},
+	22: {"FFLLSS*SYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "------*---*---*--------------------M----------------------------"},
+	23: {"FF*LSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--*-------**--*-----------------M--M---------------M------------"},
+	24: {"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG", "---M------**-------M---------------M---------------M------------"},
+	25: {"FFLLSSSSYY**CCGWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------**-----------------------M---------------M------------"},
+	26: {"FFLLSSSSYY**CC*WLLLAPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**--*----M---------------M----------------------------"},
+	27: {"FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	28: {"FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**--*--------------------M----------------------------"},
+	29: {"FFLLSSSSYYYYCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	30: {"FFLLSSSSYYEECC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "--------------*--------------------M----------------------------"},
+	31: {"FFLLSSSSYYEECCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "----------**-----------------------M----------------------------"},
+	32: {"FFLLSSSSYY*WCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", "---M------*---*----M------------MMMM---------------M------------"},
+	33: {"FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG", "---M-------*-------M---------------M---------------M------------"},
+}
+
+// ReverseComplement reverses a nucleotide sequence and complements IUPAC ambiguity codes, preserving case
+func ReverseComplement(seq string) string {
+
+	runes := []rune(seq)
+	length := len(runes)
+	result := make([]rune, length)
+
+	for i, ch := range runes {
+		switch ch {
+		case 'A':
+			ch = 'T'
+		case 'C':
+			ch = 'G'
+		case 'G':
+			ch = 'C'
+		case 'T', 'U':
+			ch = 'A'
+		case 'R':
+			ch = 'Y'
+		case 'Y':
+			ch = 'R'
+		case 'K':
+			ch = 'M'
+		case 'M':
+			ch = 'K'
+		case 'B':
+			ch = 'V'
+		case 'V':
+			ch = 'B'
+		case 'D':
+			ch = 'H'
+		case 'H':
+			ch = 'D'
+		case 'a':
+			ch = 't'
+		case 'c':
+			ch = 'g'
+		case 'g':
+			ch = 'c'
+		case 't', 'u':
+			ch = 'a'
+		case 'r':
+			ch = 'y'
+		case 'y':
+			ch = 'r'
+		case 'k':
+			ch = 'm'
+		case 'm':
+			ch = 'k'
+		case 'b':
+			ch = 'v'
+		case 'v':
+			ch = 'b'
+		case 'd':
+			ch = 'h'
+		case 'h':
+			ch = 'd'
+		default:
+			// S, W, N, and gaps are their own complements
+		}
+		result[length-i-1] = ch
+	}
+
+	return string(result)
+}
+
+// nucleotide bases represented by each IUPAC code, in T, C, A, G codon table order
+var iupacBasesIs = map[byte][]int{
+	'T': {0},
+	'U': {0},
+	'C': {1},
+	'A': {2},
+	'G': {3},
+	'Y': {0, 1},
+	'W': {0, 2},
+	'K': {0, 3},
+	'M': {1, 2},
+	'S': {1, 3},
+	'R': {2, 3},
+	'H': {0, 1, 2},
+	'B': {0, 1, 3},
+	'D': {0, 2, 3},
+	'V': {1, 2, 3},
+	'N': {0, 1, 2, 3},
+}
+
+// TranslateCodon returns the amino acid for a codon, resolving ambiguity codes when all expansions agree
+func TranslateCodon(codon string, code GeneticCode, isFirst bool) byte {
+
+	first, ok1 := iupacBasesIs[codon[0]]
+	second, ok2 := iupacBasesIs[codon[1]]
+	third, ok3 := iupacBasesIs[codon[2]]
+	if !ok1 || !ok2 || !ok3 {
+		return 'X'
+	}
+
+	var found []byte
+
+	for _, i := range first {
+		for _, j := range second {
+			for _, k := range third {
+				idx := i*16 + j*4 + k
+				aa := code.Residues[idx]
+				if isFirst && code.Starts[idx] == 'M' {
+					// alternative initiation codons are translated as methionine at the start
+					aa = 'M'
+				}
+				if len(found) == 0 || found[0] != aa {
+					duplicate := false
+					for _, prev := range found {
+						if prev == aa {
+							duplicate = true
+						}
+					}
+					if !duplicate {
+						found = append(found, aa)
+					}
+				}
+			}
+		}
+	}
+
+	if len(found) == 1 {
+		return found[0]
+	}
+
+	// ambiguous codons may still resolve to a residue pair
+	if len(found) == 2 {
+		pair := string(found)
+		switch pair {
+		case "DN", "ND":
+			return 'B'
+		case "EQ", "QE":
+			return 'Z'
+		case "IL", "LI":
+			return 'J'
+		default:
+		}
+	}
+
+	return 'X'
+}
+
+// TranslateSequence converts nucleotides to protein starting at the given frame, with optional start and stop handling
+func TranslateSequence(seq string, gcode, frame int, useStart, trimStop bool) string {
+
+	code, ok := geneticCodeIs[gcode]
+	if !ok {
+		return ""
+	}
+
+	seq = strings.ToUpper(seq)
+
+	var buffer bytes.Buffer
+
+	for i := frame - 1; i+3 <= len(seq); i += 3 {
+		aa := TranslateCodon(seq[i:i+3], code, useStart && i == frame-1)
+		buffer.WriteByte(aa)
+	}
+
+	prot := buffer.String()
+
+	if trimStop {
+		prot = strings.TrimSuffix(prot, "*")
+	}
+
+	return prot
+}
+
+// TranslationSettings obtains the genetic code and reading frame, using qualifiers of an enclosing INSDFeature
+func TranslationSettings(curr *Node, arg string) (int, int, bool, bool) {
+
+	gcode := 1
+	frame := 1
+	useStart := false
+	trimStop := false
+
+	// -gcode and -frame customizations are passed as GCODE:FRAME, and override feature qualifiers
+	gc, fr := SplitInTwoAt(arg, ":", LEFT)
+
+	var feat *Node
+	for node := curr; node != nil; node = node.Up {
+		if node.Name == "INSDFeature" {
+			feat = node
+			break
+		}
+	}
+
+	if feat != nil {
+		// translate feature like /translation, with initiation codon as methionine and without terminal stop
+		useStart = true
+		trimStop = true
+
+		for chld := feat.Children; chld != nil; chld = chld.Next {
+			switch chld.Name {
+			case "INSDFeature_partial5":
+				useStart = false
+			case "INSDFeature_location":
+				if strings.HasPrefix(chld.Contents, "<") || strings.Contains(chld.Contents, "(<") {
+					useStart = false
+				}
+			case "INSDFeature_quals":
+				for qual := chld.Children; qual != nil; qual = qual.Next {
+					name := ""
+					value := ""
+					for item := qual.Children; item != nil; item = item.Next {
+						switch item.Name {
+						case "INSDQualifier_name":
+							name = item.Contents
+						case "INSDQualifier_value":
+							value = item.Contents
+						default:
+						}
+					}
+					num, err := strconv.Atoi(value)
+					if err != nil {
+						continue
+					}
+					switch name {
+					case "transl_table":
+						gcode = num
+					case "codon_start":
+						frame = num
+					default:
+					}
+				}
+			default:
+			}
+		}
+	}
+
+	if gc != "" {
+		gcode, _ = strconv.Atoi(gc)
+	}
+	if fr != "" {
+		frame, _ = strconv.Atoi(fr)
+	}
+
+	if frame < 1 || frame > 3 {
+		frame = 1
+	}
+	if frame != 1 {
+		// codon_start greater than 1 indicates a 5' partial coding region
+		useStart = false
+	}
+
+	return gcode, frame, useStart, trimStop
+}
+
+// ExploreFeatures calls proc for each node with the given name, at or below the current node
+func ExploreFeatures(curr *Node, match string, proc func(*Node)) {
+
+	if curr == nil || proc == nil {
+		return
+	}
+
+	if curr.Name == match {
+		proc(curr)
+		return
+	}
+
+	for chld := curr.Children; chld != nil; chld = chld.Next {
+		ExploreFeatures(chld, match, proc)
+	}
+}
+
+// FeatureSequence assembles the nucleotides of an INSDFeature from INSDSeq_sequence using each INSDInterval
+func FeatureSequence(feat *Node) string {
+
+	if feat == nil {
+		return ""
+	}
+
+	// find sequence and accession in enclosing INSDSeq
+	seq := ""
+	accn := ""
+	for node := feat.Up; node != nil; node = node.Up {
+		if node.Name != "INSDSeq" {
+			continue
+		}
+		for chld := node.Children; chld != nil; chld = chld.Next {
+			switch chld.Name {
+			case "INSDSeq_sequence":
+				seq = chld.Contents
+			case "INSDSeq_accession-version":
+				accn = chld.Contents
+			default:
+			}
+		}
+		break
+	}
+
+	if seq == "" {
+		return ""
+	}
+
+	length := len(seq)
+
+	var buffer bytes.Buffer
+
+	for chld := feat.Children; chld != nil; chld = chld.Next {
+		if chld.Name != "INSDFeature_intervals" {
+			continue
+		}
+		for intv := chld.Children; intv != nil; intv = intv.Next {
+			if intv.Name != "INSDInterval" {
+				continue
+			}
+
+			from := 0
+			to := 0
+			isComp := false
+
+			for item := intv.Children; item != nil; item = item.Next {
+				switch item.Name {
+				case "INSDInterval_from":
+					from, _ = strconv.Atoi(item.Contents)
+				case "INSDInterval_to":
+					to, _ = strconv.Atoi(item.Contents)
+				case "INSDInterval_point":
+					from, _ = strconv.Atoi(item.Contents)
+					to = from
+				case "INSDInterval_iscomp":
+					isComp = strings.Contains(item.Attributes, "true")
+				case "INSDInterval_accession":
+					// cannot assemble features with intervals on other sequences
+					if accn != "" && item.Contents != accn {
+						return ""
+					}
+				default:
+				}
+			}
+
+			// complement intervals are reported with from greater than to
+			if from > to {
+				from, to = to, from
+				isComp = true
+			}
+			if from < 1 || to > length {
+				return ""
+			}
+
+			str := seq[from-1 : to]
+			if isComp {
+				str = ReverseComplement(str)
+			}
+			buffer.WriteString(str)
+		}
+	}
+
+	return buffer.String()
+}
+
+// ResidueCounts tallies each letter in a sequence, ignoring case
+func ResidueCounts(seq string) map[rune]int {
+
+	counts := make(map[rune]int)
+
+	for _, ch := range strings.ToUpper(seq) {
+		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+			continue
+		}
+		counts[ch]++
+	}
+
+	return counts
+}
+
+// SequenceComposition returns residues in alphabetical order with their counts
+func SequenceComposition(seq string) []string {
+
+	counts := ResidueCounts(seq)
+
+	var keys []string
+	for ch := range counts {
+		keys = append(keys, string(ch))
+	}
+	sort.Strings(keys)
+
+	var res []string
+	for _, key := range keys {
+		ch := []rune(key)[0]
+		res = append(res, key+"\t"+strconv.Itoa(counts[ch]))
+	}
+
+	return res
+}
+
+// SequenceIsProtein uses INSDSeq_moltype of an enclosing INSDSeq, otherwise looks for non-nucleotide letters
+func SequenceIsProtein(curr *Node, seq string) bool {
+
+	for node := curr; node != nil; node = node.Up {
+		if node.Name != "INSDSeq" {
+			continue
+		}
+		for chld := node.Children; chld != nil; chld = chld.Next {
+			if chld.Name == "INSDSeq_moltype" {
+				return chld.Contents == "AA"
+			}
+		}
+		break
+	}
+
+	for _, ch := range strings.ToUpper(seq) {
+		if !strings.ContainsRune("ACGTUNRYSWKMBDHV-", ch) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GCContent returns the percentage of G, C, and S among unambiguous strong and weak bases
+func GCContent(seq string) (string, bool) {
+
+	strong := 0
+	weak := 0
+
+	for _, ch := range strings.ToUpper(seq) {
+		switch ch {
+		case 'G', 'C', 'S':
+			strong++
+		case 'A', 'T', 'U', 'W':
+			weak++
+		default:
+		}
+	}
+
+	if strong+weak == 0 {
+		return "", false
+	}
+
+	pct := float64(strong) * 100.0 / float64(strong+weak)
+
+	return strconv.FormatFloat(pct, 'f', 2, 64), true
+}
+
+// AmbiguousBases counts nucleotide letters other than A, C, G, T, and U
+func AmbiguousBases(seq string) int {
+
+	count := 0
+
+	for _, ch := range strings.ToUpper(seq) {
+		if unicode.IsLetter(ch) && !strings.ContainsRune("ACGTU", ch) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// average residue masses, amino acid minus water
+var residueMassIs = map[rune]float64{
+	'A': 71.0788,
+	'B': 114.5962,
+	'C': 103.1388,
+	'D': 115.0886,
+	'E': 129.1155,
+	'F': 147.1766,
+	'G': 57.0519,
+	'H': 137.1411,
+	'I': 113.1594,
+	'J': 113.1594,
+	'K': 128.1741,
+	'L': 113.1594,
+	'M': 131.1926,
+	'N': 114.1038,
+	'O': 237.3018,
+	'P': 97.1167,
+	'Q': 128.1307,
+	'R': 156.1875,
+	'S': 87.0782,
+	'T': 101.1051,
+	'U': 150.0388,
+	'V': 99.1326,
+	'W': 186.2132,
+	'X': 111.1,
+	'Y': 163.1760,
+	'Z': 128.6231,
+}
+
+// anhydrous nucleotide monophosphate masses for single-stranded DNA and RNA
+var (
+	dnaMassIs = map[rune]float64{
+		'A': 313.21,
+		'C': 289.18,
+		'G': 329.21,
+		'T': 304.2,
+	}
+	rnaMassIs = map[rune]float64{
+		'A': 329.21,
+		'C': 305.18,
+		'G': 345.21,
+		'U': 306.17,
+	}
+)
+
+// MolecularWeight computes average mass in daltons, ambiguous nucleotides use the mean of the four bases
+func MolecularWeight(seq string, isProtein bool) (string, bool) {
+
+	seq = strings.ToUpper(seq)
+	mass := 0.0
+	count := 0
+
+	if isProtein {
+		for _, ch := range seq {
+			if val, ok := residueMassIs[ch]; ok {
+				mass += val
+				count++
+			}
+		}
+		if count == 0 {
+			return "", false
+		}
+		// add one water for the free amino and carboxyl termini
+		mass += 18.01524
+		return strconv.FormatFloat(mass, 'f', 2, 64), true
+	}
+
+	masses := dnaMassIs
+	adjust := -61.96
+	if strings.ContainsRune(seq, 'U') && !strings.ContainsRune(seq, 'T') {
+		masses = rnaMassIs
+		adjust = 159.0
+	}
+
+	mean := 0.0
+	for _, val := range masses {
+		mean += val
+	}
+	mean /= 4.0
+
+	for _, ch := range seq {
+		if val, ok := masses[ch]; ok {
+			mass += val
+			count++
+		} else if unicode.IsLetter(ch) {
+			mass += mean
+			count++
+		}
+	}
+	if count == 0 {
+		return "", false
+	}
+	mass += adjust
+
+	return strconv.FormatFloat(mass, 'f', 2, 64), true
+}
+
+// IsoelectricPoint finds the pH of zero net charge by bisection, using EMBOSS pKa values
+func IsoelectricPoint(seq string) (string, bool) {
+
+	counts := ResidueCounts(seq)
+
+	total := 0
+	for ch, num := range counts {
+		if _, ok := residueMassIs[ch]; ok {
+			total += num
+		}
+	}
+	if total == 0 {
+		return "", false
+	}
+
+	positive := func(pH, pK float64) float64 {
+		return 1.0 / (1.0 + math.Pow(10, pH-pK))
+	}
+	negative := func(pH, pK float64) float64 {
+		return -1.0 / (1.0 + math.Pow(10, pK-pH))
+	}
+
+	charge := func(pH float64) float64 {
+		chg := positive(pH, 8.6) + negative(pH, 3.6)
+		chg += float64(counts['K']) * positive(pH, 10.8)
+		chg += float64(counts['R']) * positive(pH, 12.5)
+		chg += float64(counts['H']) * positive(pH, 6.5)
+		chg += float64(counts['D']) * negative(pH, 3.9)
+		chg += float64(counts['E']) * negative(pH, 4.1)
+		chg += float64(counts['C']) * negative(pH, 8.5)
+		chg += float64(counts['Y']) * negative(pH, 10.1)
+		return chg
+	}
+
+	lo := 0.0
+	hi := 14.0
+	for hi-lo > 0.0001 {
+		mid := (lo + hi) / 2.0
+		if charge(mid) > 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return strconv.FormatFloat((lo+hi)/2.0, 'f', 2, 64), true
+}
+
+type OpenReadingFrame struct {
+	Frame       string
+	Start       int
+	Stop        int
+	Translation string
+}
+
+// FindOpenReadingFrames scans six frames for start codons followed by an in-frame stop codon
+func FindOpenReadingFrames(seq string, gcode, minLen int, starts []string) []OpenReadingFrame {
+
+	code, ok := geneticCodeIs[gcode]
+	if !ok {
+		return nil
+	}
+
+	isStart := make(map[string]bool)
+	for _, str := range starts {
+		isStart[strings.ToUpper(str)] = true
+	}
+
+	var res []OpenReadingFrame
+
+	seq = strings.Replace(strings.ToUpper(seq), "U", "T", -1)
+	length := len(seq)
+
+	for _, strand := range []string{"+", "-"} {
+
+		str := seq
+		if strand == "-" {
+			str = ReverseComplement(seq)
+		}
+
+		for frame := 0; frame < 3; frame++ {
+
+			i := frame
+			for i+3 <= length {
+
+				if !isStart[str[i:i+3]] {
+					i += 3
+					continue
+				}
+
+				// find first in-frame stop codon
+				j := i + 3
+				for j+3 <= length && TranslateCodon(str[j:j+3], code, false) != '*' {
+					j += 3
+				}
+				if j+3 > length {
+					// reading frame runs off end of sequence
+					break
+				}
+
+				if (j-i)/3 >= minLen {
+					orf := OpenReadingFrame{Frame: strand + strconv.Itoa(frame+1)}
+					// report 1-based positions on original strand, start is greater than stop on minus strand
+					if strand == "+" {
+						orf.Start = i + 1
+						orf.Stop = j + 3
+					} else {
+						orf.Start = length - i
+						orf.Stop = length - j - 2
+					}
+					orf.Translation = TranslateSequence(str[i:j+3], gcode, 1, true, true)
+					// requested start codons outside the genetic code's start table still begin with methionine
+					if orf.Translation != "" && orf.Translation[0] != 'M' {
+						orf.Translation = "M" + orf.Translation[1:]
+					}
+					res = append(res, orf)
+				}
+
+				// nested starts share the same stop codon, continue after it
+				i = j + 3
+			}
+		}
+	}
+
+	return res
+}
+
+// AddOpenReadingFrames inserts ORF objects after each sequence element selected by -orf
+func AddOpenReadingFrames(curr *Node, tbls *Tables) {
+
+	if curr == nil || tbls == nil {
+		return
+	}
+
+	// addChild appends a text-only element to an ORF object
+	addChild := func(orf, last *Node, name, value string) *Node {
+		node := &Node{Name: name, Parent: "ORF", Contents: value, Up: orf}
+		if last == nil {
+			orf.Children = node
+		} else {
+			last.Next = node
+		}
+		return node
+	}
+
+	ExploreFeatures(curr, tbls.OrfElem, func(node *Node) {
+
+		prev := node
+
+		for _, item := range FindOpenReadingFrames(node.Contents, tbls.OrfCode, tbls.OrfMin, tbls.OrfStarts) {
+
+			orf := &Node{Name: "ORF", Parent: node.Parent, Up: node.Up}
+
+			last := addChild(orf, nil, "ORF_frame", item.Frame)
+			last = addChild(orf, last, "ORF_start", strconv.Itoa(item.Start))
+			last = addChild(orf, last, "ORF_stop", strconv.Itoa(item.Stop))
+			last = addChild(orf, last, "ORF_length", strconv.Itoa(len(item.Translation)))
+			addChild(orf, last, "ORF_translation", item.Translation)
+
+			// link as next sibling of sequence element
+			orf.Next = prev.Next
+			prev.Next = orf
+			prev = orf
+		}
+	})
+}
+
+// LOOKUP TABLE JOINS
+
+// lookupIs maps the first column of -lookup files to the remaining columns, joined by tabs
+var lookupIs = make(map[string]string)
+
+// ReadLookupTable loads a tab-delimited file, keeping the first row for each key
+func ReadLookupTable(fname string) {
+
+	inFile, err := os.Open(fname)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to open lookup file '%s'\n", fname)
+		os.Exit(1)
+	}
+	defer inFile.Close()
+
+	scanr := bufio.NewScanner(inFile)
+	// allow long rows of annotation
+	scanr.Buffer(make([]byte, 65536), 16777216)
+
+	for scanr.Scan() {
+
+		line := strings.TrimRight(scanr.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, vals := SplitInTwoAt(line, "\t", LEFT)
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		if _, ok := lookupIs[key]; !ok {
+			lookupIs[key] = vals
+		}
+	}
+
+	if err := scanr.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to read lookup file '%s'\n", fname)
+		os.Exit(1)
+	}
+}
+
+// LookupValue returns the columns mapped from a key, or an empty string if the key is absent
+func LookupValue(str string) (string, bool) {
+
+	vals, ok := lookupIs[strings.TrimSpace(str)]
+
+	return vals, ok
+}
+
+// ACCESSION CLASSIFICATION
+
+type AccessionFormat struct {
+	Pattern  *regexp.Regexp
+	Database string
+	Kind     string
+}
+
+// accessionFormats are tested in order, submatches are prefix, number, and optional version
+var accessionFormats = []AccessionFormat{
+	{regexp.MustCompile(`^()([0-9]+)()$`), "pubmed", "pmid"},
+	{regexp.MustCompile(`^(PMID:?)([0-9]+)()$`), "pubmed", "pmid"},
+	{regexp.MustCompile(`^(PMC)([0-9]+)(?:\.([0-9]+))?$`), "pmc", "pmcid"},
+	{regexp.MustCompile(`^(GC[AF]_)([0-9]{9})(?:\.([0-9]+))?$`), "assembly", "assembly"},
+	{regexp.MustCompile(`^([A-Z]{2}_)([0-9]{6,9})(?:\.([0-9]+))?$`), "", "refseq"},
+	{regexp.MustCompile(`^(PRJ[A-Z]{2})([0-9]+)()$`), "bioproject", "bioproject"},
+	{regexp.MustCompile(`^(SAM[A-Z]{1,2})([0-9]+)()$`), "biosample", "biosample"},
+	{regexp.MustCompile(`^([SED]R[APRSXZ])([0-9]{6,})()$`), "sra", "sra"},
+	{regexp.MustCompile(`^()([OPQ][0-9][A-Z0-9]{3}[0-9])(?:\.([0-9]+))?$`), "protein", "uniprot"},
+	{regexp.MustCompile(`^()([A-NR-Z][0-9](?:[A-Z][A-Z0-9]{2}[0-9]){1,2})(?:\.([0-9]+))?$`), "protein", "uniprot"},
+	{regexp.MustCompile(`^()([0-9][A-Z0-9]{3}(?:_[A-Z0-9]+)?)()$`), "structure", "pdb"},
+	{regexp.MustCompile(`^([A-Z])([0-9]{5})(?:\.([0-9]+))?$`), "nuccore", "genbank"},
+	{regexp.MustCompile(`^([A-Z]{2})([0-9]{6}|[0-9]{8})(?:\.([0-9]+))?$`), "nuccore", "genbank"},
+	{regexp.MustCompile(`^([A-Z]{3})([0-9]{5}|[0-9]{7})(?:\.([0-9]+))?$`), "protein", "genpept"},
+	{regexp.MustCompile(`^([A-Z]{4}|[A-Z]{6})([0-9]{8,11})(?:\.([0-9]+))?$`), "nuccore", "wgs"},
+	{regexp.MustCompile(`^([A-Z]{5})([0-9]{7})(?:\.([0-9]+))?$`), "nuccore", "mga"},
+}
+
+// refseqTypeIs maps RefSeq prefixes to molecule type
+var refseqTypeIs = map[string]string{
+	"AC_": "genomic",
+	"AP_": "protein",
+	"NC_": "genomic",
+	"NG_": "genomic",
+	"NM_": "mRNA",
+	"NP_": "protein",
+	"NR_": "ncRNA",
+	"NT_": "contig",
+	"NW_": "contig",
+	"NZ_": "wgs",
+	"WP_": "protein",
+	"XM_": "mRNA",
+	"XP_": "protein",
+	"XR_": "ncRNA",
+	"YP_": "protein",
+}
+
+// ParseAccession returns prefix, number, version, database, and type, with dashes for missing fields
+func ParseAccession(str string) []string {
+
+	str = strings.ToUpper(strings.TrimSpace(str))
+
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	for _, frmt := range accessionFormats {
+		parts := frmt.Pattern.FindStringSubmatch(str)
+		if parts == nil {
+			continue
+		}
+		db := frmt.Database
+		kind := frmt.Kind
+		if kind == "refseq" {
+			// molecule type and database are inferred from RefSeq prefix
+			mol, ok := refseqTypeIs[parts[1]]
+			if !ok {
+				break
+			}
+			kind = mol
+			db = "nuccore"
+			if mol == "protein" {
+				db = "protein"
+			}
+		}
+		return []string{dash(parts[1]), parts[2], dash(parts[3]), db, kind}
+	}
+
+	return []string{"-", "-", "-", "invalid", "invalid"}
+}
+
+// VARIABLE EXPRESSIONS
+
+// Expression is a node in a parsed -VARIABLE "[...]" computation
+type Expression struct {
+	Oper  string
+	Value string
+	Elem  *Operation
+	Args  []*Expression
+}
+
+// functionArity records the minimum and maximum number of arguments for expression functions, -1 is unlimited
+var functionArity = map[string][2]int{
+	"abs":    {1, 1},
+	"ceil":   {1, 1},
+	"concat": {1, -1},
+	"floor":  {1, 1},
+	"if":     {3, 3},
+	"len":    {1, 1},
+	"max":    {1, -1},
+	"min":    {1, -1},
+	"round":  {1, 1},
+}
+
+// LexExpression splits an expression into numbers, quoted strings, variables, names, and operators
+func LexExpression(str string) []string {
+
+	var tokens []string
+
+	isNameChar := func(ch byte) bool {
+		return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '_' || ch == '.' || ch == ':' || ch == '/' || ch == '@'
+	}
+
+	isLetter := func(ch byte) bool {
+		return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z')
+	}
+
+	max := len(str)
+	idx := 0
+
+	for idx < max {
+		ch := str[idx]
+		start := idx
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			idx++
+			continue
+		case ch == '"' || ch == '\'':
+			// quoted strings keep leading quote to distinguish them from names
+			idx++
+			for idx < max && str[idx] != ch {
+				idx++
+			}
+			if idx >= max {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unterminated string in expression '%s'\n", str)
+				os.Exit(1)
+			}
+			tokens = append(tokens, "'"+str[start+1:idx])
+			idx++
+		case ch >= '0' && ch <= '9':
+			for idx < max && ((str[idx] >= '0' && str[idx] <= '9') || str[idx] == '.') {
+				idx++
+			}
+			tokens = append(tokens, str[start:idx])
+		case ch == '&' && (idx+1 >= max || str[idx+1] != '&'):
+			idx++
+			for idx < max && ((str[idx] >= 'A' && str[idx] <= 'Z') || (str[idx] >= '0' && str[idx] <= '9')) {
+				idx++
+			}
+			if idx == start+1 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Missing variable name in expression '%s'\n", str)
+				os.Exit(1)
+			}
+			tokens = append(tokens, str[start:idx])
+		case isNameChar(ch) || (ch == '#' && idx+1 < max && isNameChar(str[idx+1])):
+			// leading pound sign counts elements, e.g., #Author
+			if ch == '#' {
+				idx++
+			}
+			// hyphen followed by a letter stays within element names, e.g., Gene-ref_locus
+			for idx < max && (isNameChar(str[idx]) || (str[idx] == '-' && idx+1 < max && isLetter(str[idx+1]))) {
+				idx++
+			}
+			tokens = append(tokens, str[start:idx])
+		default:
+			if idx+1 < max {
+				two := str[idx : idx+2]
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, two)
+					idx += 2
+					continue
+				}
+			}
+			switch ch {
+			case '+', '-', '*', '/', '%', '<', '>', '!', '(', ')', ',':
+				tokens = append(tokens, string(ch))
+				idx++
+			default:
+				fmt.Fprintf(os.Stderr, "\nERROR: Unexpected character '%c' in expression '%s'\n", ch, str)
+				os.Exit(1)
+			}
+		}
+	}
+
+	return tokens
+}
+
+// ParseExpression builds an expression tree, calling element to prepare each element name reference
+func ParseExpression(str string, element func(string) *Operation) *Expression {
+
+	tokens := LexExpression(str)
+	max := len(tokens)
+	idx := 0
+
+	peek := func() string {
+		if idx < max {
+			return tokens[idx]
+		}
+		return ""
+	}
+
+	fail := func(msg string) {
+		fmt.Fprintf(os.Stderr, "\nERROR: %s in expression '%s'\n", msg, str)
+		os.Exit(1)
+	}
+
+	// parseBinary recursive definition
+	var parseBinary func(level int) *Expression
+
+	// operator precedence from loosest to tightest binding
+	levels := [][]string{
+		{"||"},
+		{"&&"},
+		{"==", "!=", "<", "<=", ">", ">="},
+		{"+", "-"},
+		{"*", "/", "%"},
+	}
+
+	// parseUnary handles prefix operators, literals, variables, functions, elements, and parentheses
+	var parseUnary func() *Expression
+
+	parseUnary = func() *Expression {
+
+		tkn := peek()
+		if tkn == "" {
+			fail("Unexpected end")
+		}
+		idx++
+
+		switch {
+		case tkn == "-" || tkn == "!":
+			return &Expression{Oper: tkn, Args: []*Expression{parseUnary()}}
+		case tkn == "(":
+			expr := parseBinary(0)
+			if peek() != ")" {
+				fail("Missing closing parenthesis")
+			}
+			idx++
+			return expr
+		case tkn[0] == '\'':
+			return &Expression{Oper: "str", Value: tkn[1:]}
+		case tkn[0] == '&':
+			return &Expression{Oper: "var", Value: tkn[1:]}
+		case tkn[0] >= '0' && tkn[0] <= '9':
+			if _, err := strconv.ParseFloat(tkn, 64); err != nil {
+				fail("Bad number '" + tkn + "'")
+			}
+			return &Expression{Oper: "str", Value: tkn}
+		case len(tkn) == 1 && strings.Contains("+*/%<>=,)", tkn):
+			fail("Unexpected '" + tkn + "'")
+		default:
+		}
+
+		arity, isFunc := functionArity[tkn]
+		if !isFunc || peek() != "(" {
+			// any other name is the first value of an element
+			return &Expression{Oper: "elem", Value: tkn, Elem: element(tkn)}
+		}
+
+		idx++
+		expr := &Expression{Oper: "call", Value: tkn}
+		if peek() != ")" {
+			for {
+				expr.Args = append(expr.Args, parseBinary(0))
+				if peek() != "," {
+					break
+				}
+				idx++
+			}
+		}
+		if peek() != ")" {
+			fail("Missing closing parenthesis after " + tkn + " arguments")
+		}
+		idx++
+
+		num := len(expr.Args)
+		if num < arity[0] || (arity[1] >= 0 && num > arity[1]) {
+			fail("Wrong number of arguments to " + tkn)
+		}
+
+		return expr
+	}
+
+	parseBinary = func(level int) *Expression {
+
+		if level >= len(levels) {
+			return parseUnary()
+		}
+
+		lft := parseBinary(level + 1)
+
+		for {
+			tkn := peek()
+			found := false
+			for _, op := range levels[level] {
+				if tkn == op {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return lft
+			}
+			idx++
+			rgt := parseBinary(level + 1)
+			lft = &Expression{Oper: tkn, Args: []*Expression{lft, rgt}}
+		}
+	}
+
+	if max == 0 {
+		fail("Empty contents")
+	}
+
+	expr := parseBinary(0)
+	if idx < max {
+		fail("Unexpected '" + tokens[idx] + "'")
+	}
+
+	return expr
+}
+
+// ParseNumber returns a value as an integer if possible, otherwise as a floating-point number
+func ParseNumber(str string) (int64, float64, bool, bool) {
+
+	if num, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return num, float64(num), true, true
+	}
+	if flt, err := strconv.ParseFloat(str, 64); err == nil {
+		return 0, flt, false, true
+	}
+
+	return 0, 0, false, false
+}
+
+// FormatFloat prints a floating-point result without trailing zeros
+func FormatFloat(flt float64) string {
+
+	return strconv.FormatFloat(flt, 'f', -1, 64)
+}
+
+// EvaluateExpression computes the value of an expression, failing if a required value is missing or not numeric
+func EvaluateExpression(expr *Expression, curr *Node, mask string, index, level int, variables map[string]string) (string, bool) {
+
+	if expr == nil {
+		return "", false
+	}
+
+	truth := func(flag bool) (string, bool) {
+		if flag {
+			return "1", true
+		}
+		return "0", true
+	}
+
+	isTrue := func(str string) bool {
+		return str != "" && str != "0"
+	}
+
+	eval := func(sub *Expression) (string, bool) {
+		return EvaluateExpression(sub, curr, mask, index, level, variables)
+	}
+
+	switch expr.Oper {
+	case "str":
+		return expr.Value, true
+	case "var":
+		val, ok := variables[expr.Value]
+		return val, ok
+	case "elem":
+		if expr.Elem == nil {
+			return "", false
+		}
+		return ProcessClause(curr, expr.Elem.Stages, mask, "", "", "", "\t", "", "", FIRST, index, level, variables, nil)
+	case "!":
+		val, _ := eval(expr.Args[0])
+		return truth(!isTrue(val))
+	case "&&":
+		// logical operators only evaluate the right side when needed
+		val, _ := eval(expr.Args[0])
+		if !isTrue(val) {
+			return truth(false)
+		}
+		val, _ = eval(expr.Args[1])
+		return truth(isTrue(val))
+	case "||":
+		val, _ := eval(expr.Args[0])
+		if isTrue(val) {
+			return truth(true)
+		}
+		val, _ = eval(expr.Args[1])
+		return truth(isTrue(val))
+	case "call":
+		return EvaluateFunction(expr, curr, mask, index, level, variables)
+	default:
+	}
+
+	// remaining operators require all operands
+	var vals []string
+	for _, sub := range expr.Args {
+		val, ok := eval(sub)
+		if !ok {
+			return "", false
+		}
+		vals = append(vals, val)
+	}
+
+	if expr.Oper == "-" && len(vals) == 1 {
+		num, flt, isInt, ok := ParseNumber(vals[0])
+		if !ok {
+			return "", false
+		}
+		if isInt {
+			return strconv.FormatInt(-num, 10), true
+		}
+		return FormatFloat(-flt), true
+	}
+
+	if len(vals) != 2 {
+		return "", false
+	}
+
+	lftNum, lftFlt, lftInt, lftOk := ParseNumber(vals[0])
+	rgtNum, rgtFlt, rgtInt, rgtOk := ParseNumber(vals[1])
+
+	switch expr.Oper {
+	case "==", "!=", "<", "<=", ">", ">=":
+		// compare numerically if both sides are numbers, otherwise compare as strings
+		cmp := strings.Compare(vals[0], vals[1])
+		if lftOk && rgtOk {
+			cmp = 0
+			if lftFlt < rgtFlt {
+				cmp = -1
+			} else if lftFlt > rgtFlt {
+				cmp = 1
+			}
+		}
+		switch expr.Oper {
+		case "==":
+			return truth(cmp == 0)
+		case "!=":
+			return truth(cmp != 0)
+		case "<":
+			return truth(cmp < 0)
+		case "<=":
+			return truth(cmp <= 0)
+		case ">":
+			return truth(cmp > 0)
+		case ">=":
+			return truth(cmp >= 0)
+		}
+	default:
+	}
+
+	if !lftOk || !rgtOk {
+		return "", false
+	}
+
+	if lftInt && rgtInt {
+		// integer arithmetic, division stays integer only if exact
+		switch expr.Oper {
+		case "+":
+			return strconv.FormatInt(lftNum+rgtNum, 10), true
+		case "-":
+			return strconv.FormatInt(lftNum-rgtNum, 10), true
+		case "*":
+			return strconv.FormatInt(lftNum*rgtNum, 10), true
+		case "/":
+			if rgtNum == 0 {
+				return "", false
+			}
+			if lftNum%rgtNum == 0 {
+				return strconv.FormatInt(lftNum/rgtNum, 10), true
+			}
+			return FormatFloat(lftFlt / rgtFlt), true
+		case "%":
+			if rgtNum == 0 {
+				return "", false
+			}
+			return strconv.FormatInt(lftNum%rgtNum, 10), true
+		}
+	}
+
+	switch expr.Oper {
+	case "+":
+		return FormatFloat(lftFlt + rgtFlt), true
+	case "-":
+		return FormatFloat(lftFlt - rgtFlt), true
+	case "*":
+		return FormatFloat(lftFlt * rgtFlt), true
+	case "/":
+		if rgtFlt == 0 {
+			return "", false
+		}
+		return FormatFloat(lftFlt / rgtFlt), true
+	case "%":
+		if rgtFlt == 0 {
+			return "", false
+		}
+		return FormatFloat(math.Mod(lftFlt, rgtFlt)), true
+	default:
+	}
+
+	return "", false
+}
+
+// EvaluateFunction computes the value of a built-in expression function
+func EvaluateFunction(expr *Expression, curr *Node, mask string, index, level int, variables map[string]string) (string, bool) {
+
+	eval := func(sub *Expression) (string, bool) {
+		return EvaluateExpression(sub, curr, mask, index, level, variables)
+	}
+
+	switch expr.Value {
+	case "if":
+		// only the selected branch is evaluated
+		val, _ := eval(expr.Args[0])
+		if val != "" && val != "0" {
+			return eval(expr.Args[1])
+		}
+		return eval(expr.Args[2])
+	case "concat":
+		// missing pieces are skipped
+		var buffer bytes.Buffer
+		ok := false
+		for _, sub := range expr.Args {
+			val, found := eval(sub)
+			if found {
+				buffer.WriteString(val)
+				ok = true
+			}
+		}
+		return buffer.String(), ok
+	case "min", "max":
+		// missing or non-numeric arguments are ignored, as with -min and -max
+		best := ""
+		bestFlt := 0.0
+		for _, sub := range expr.Args {
+			val, found := eval(sub)
+			if !found {
+				continue
+			}
+			_, flt, _, isNum := ParseNumber(val)
+			if !isNum {
+				continue
+			}
+			if best == "" || (expr.Value == "min" && flt < bestFlt) || (expr.Value == "max" && flt > bestFlt) {
+				best = val
+				bestFlt = flt
+			}
+		}
+		return best, best != ""
+	default:
+	}
+
+	val, ok := eval(expr.Args[0])
+	if !ok {
+		return "", false
+	}
+
+	if expr.Value == "len" {
+		return strconv.Itoa(len([]rune(val))), true
+	}
+
+	num, flt, isInt, isNum := ParseNumber(val)
+	if !isNum {
+		return "", false
+	}
+
+	switch expr.Value {
+	case "abs":
+		if isInt {
+			if num < 0 {
+				num = -num
+			}
+			return strconv.FormatInt(num, 10), true
+		}
+		return FormatFloat(math.Abs(flt)), true
+	case "round", "floor", "ceil":
+		if isInt {
+			return strconv.FormatInt(num, 10), true
+		}
+		switch expr.Value {
+		case "round":
+			// round half away from zero
+			if flt < 0 {
+				flt = -math.Floor(-flt + 0.5)
+			} else {
+				flt = math.Floor(flt + 0.5)
+			}
+		case "floor":
+			flt = math.Floor(flt)
+		case "ceil":
+			flt = math.Ceil(flt)
+		}
+		return FormatFloat(flt), true
+	default:
+	}
+
+	return "", false
+}
+
+// COLLECT AND FORMAT REQUESTED XML VALUES
+
+// ParseAttributes is only run if attribute values are requested in element statements
+func ParseAttributes(attrb string) []string {
+
+	if attrb == "" {
+		return nil
+	}
+
+	attlen := len(attrb)
+
+	// count equal signs
+	num := 0
+	for i := 0; i < attlen; i++ {
+		if attrb[i] == '=' {
+			num += 2
+		}
+	}
+	if num < 1 {
+		return nil
+	}
+
+	// allocate array of proper size
+	arry := make([]string, num)
+	if arry == nil {
+		return nil
+	}
+
+	start := 0
+	idx := 0
+	itm := 0
+
+	// place tag and value in successive array slots
+	for idx < attlen && itm < num {
+		ch := attrb[idx]
+		if ch == '=' {
+			// skip past possible leading blanks
+			for start < attlen {
+				ch = attrb[start]
+				if ch == ' ' || ch == '\n' || ch == '\t' || ch == '\r' || ch == '\f' {
+					start++
+				} else {
+					break
+				}
+			}
+			// =
+			arry[itm] = attrb[start:idx]
+			itm++
+			// skip past equal sign and leading double quote
+			idx += 2
+			start = idx
+		} else if ch == '"' {
+			// "
+			arry[itm] = attrb[start:idx]
+			itm++
+			// skip past trailing double quote and (possible) space
+			idx += 2
+			start = idx
+		} else {
+			idx++
+		}
+	}
+
+	return arry
+}
+
+// ExploreElements returns matching element values to callback
+func ExploreElements(curr *Node, mask, prnt, match, attrib string, wildcard bool, level int, proc func(string, int)) {
+
+	if curr == nil || proc == nil {
+		return
+	}
+
+	// **/Object performs deep exploration of recursive data (*/Object also supported)
+	deep := false
+	if prnt == "**" || prnt == "*" {
+		prnt = ""
+		deep = true
+	}
+
+	// exploreElements recursive definition
+	var exploreElements func(curr *Node, skip string, lev int)
+
+	exploreElements = func(curr *Node, skip string, lev int) {
+
+		if !deep && curr.Name == skip {
+			// do not explore within recursive object
+			return
+		}
+
+		// wildcard matches any namespace prefix
+		if curr.Name == match ||
+			(wildcard && strings.HasPrefix(match, ":") && strings.HasSuffix(curr.Name, match)) ||
+			(match == "" && attrib != "") {
+
+			if prnt == "" ||
+				curr.Parent == prnt ||
+				(wildcard && strings.HasPrefix(prnt, ":") && strings.HasSuffix(curr.Parent, prnt)) {
+
+				if attrib != "" {
+					if curr.Attributes != "" && curr.Attribs == nil {
+						// parse attributes on-the-fly if queried
+						curr.Attribs = ParseAttributes(curr.Attributes)
+					}
+					for i := 0; i < len(curr.Attribs)-1; i += 2 {
+						// attributes now parsed into array as [ tag, value, tag, value, tag, value, ... ]
+						if curr.Attribs[i] == attrib ||
+							(wildcard && strings.HasPrefix(attrib, ":") && strings.HasSuffix(curr.Attribs[i], attrib)) {
+							proc(curr.Attribs[i+1], level)
+							return
+						}
+					}
+
+				} else if curr.Contents != "" {
+
+					str := curr.Contents[:]
+
+					if HasAmpOrNotASCII(str) {
+						// processing of <, >, &, ", and ' characters is now delayed until element contents is requested
+						str = html.UnescapeString(str)
+					}
+
+					proc(str, level)
+					return
+
+				} else if curr.Children != nil {
+
+					// for XML container object, send empty string to callback to increment count
+					proc("", level)
+					// and continue exploring
+
+				} else if curr.Attributes != "" {
+
+					// for self-closing object, indicate presence by sending empty string to callback
+					proc("", level)
+					return
+				}
+			}
+		}
+
+		for chld := curr.Children; chld != nil; chld = chld.Next {
+			// inner exploration is subject to recursive object exclusion
+			exploreElements(chld, mask, lev+1)
+		}
+	}
+
+	exploreElements(curr, "", level)
+}
+
+// ClimbHops follows ancestor and sibling navigation steps from the current node
+func ClimbHops(curr *Node, hops []string) *Node {
+
+	for _, hop := range hops {
+
+		if curr == nil {
+			return nil
+		}
+
+		switch {
+		case hop == "..":
+			// enclosing object
+			curr = curr.Up
+		case strings.HasPrefix(hop, ".."):
+			// nearest ancestor with given name
+			name := hop[2:]
+			for curr = curr.Up; curr != nil; curr = curr.Up {
+				if curr.Name == name {
+					break
+				}
+			}
+		case strings.HasPrefix(hop, ">"):
+			// next following sibling, optionally with given name
+			name := hop[1:]
+			for curr = curr.Next; curr != nil; curr = curr.Next {
+				if name == "" || curr.Name == name {
+					break
+				}
+			}
+		case strings.HasPrefix(hop, "<"):
+			// nearest preceding sibling, optionally with given name
+			if curr.Up == nil {
+				return nil
+			}
+			name := hop[1:]
+			var prev *Node
+			for chld := curr.Up.Children; chld != nil && chld != curr; chld = chld.Next {
+				if name == "" || chld.Name == name {
+					prev = chld
+				}
+			}
+			curr = prev
+		default:
+			return nil
+		}
+	}
+
+	return curr
+}
+
+// ExploreRelatives returns matching element values of an ancestor or sibling to callback
+func ExploreRelatives(curr *Node, hops []string, prnt, match, attrib string, wildcard bool, level int, proc func(string, int)) {
+
+	node := ClimbHops(curr, hops)
+	if node == nil {
+		return
+	}
+
+	// relative is outside of the current object, so recursive object exclusion does not apply
+	mask := ""
+
+	if prnt == "" && match == "" {
+		// path ends at the relative itself, e.g., "../" or ">Keyword"
+		match = node.Name
+		mask = node.Name
+	}
+
+	ExploreElements(node, mask, prnt, match, attrib, wildcard, level, proc)
+}
+
+// PrintSubtree supports compression styles selected by -element "*" through "****"
+func PrintSubtree(node *Node, style IndentType, printAttrs bool, proc func(string)) {
+
+	if node == nil || proc == nil {
+		return
+	}
+
+	// WRAPPED is SUBTREE plus each attribute on its own line
+	wrapped := false
+	if style == WRAPPED {
+		style = SUBTREE
+		wrapped = true
+	}
+
+	// INDENT is offset by two spaces to allow for parent tag, SUBTREE is not offset
+	initial := 1
+	if style == SUBTREE {
+		style = INDENT
+		initial = 0
+	}
+
+	// array to speed up indentation
+	indentSpaces := []string{
+		"",
+		"  ",
+		"    ",
+		"      ",
+		"        ",
+		"          ",
+		"            ",
+		"              ",
+		"                ",
+		"                  ",
+	}
+
+	// indent a specified number of spaces
+	doIndent := func(indt int) {
+		i := indt
+		for i > 9 {
+			proc("                    ")
+			i -= 10
+		}
+		if i < 0 {
+			return
+		}
+		proc(indentSpaces[i])
+	}
+
+	// doSubtree recursive definition
+	var doSubtree func(*Node, int)
+
+	doSubtree = func(curr *Node, depth int) {
+
+		// suppress if it would be an empty self-closing tag
+		if !IsNotJustWhitespace(curr.Attributes) && curr.Contents == "" && curr.Children == nil {
+			return
+		}
+
+		if style == INDENT {
+			doIndent(depth)
+		}
+
+		proc("<")
+		proc(curr.Name)
+
+		if printAttrs {
+
+			attr := strings.TrimSpace(curr.Attributes)
+			attr = CompressRunsOfSpaces(attr)
+
+			if attr != "" {
+
+				if wrapped {
+
+					start := 0
+					idx := 0
+
+					attlen := len(attr)
+
+					for idx < attlen {
+						ch := attr[idx]
+						if ch == '=' {
+							str := attr[start:idx]
+							proc("\n")
+							doIndent(depth)
+							proc(" ")
+							proc(str)
+							// skip past equal sign and leading double quote
+							idx += 2
+							start = idx
+						} else if ch == '"' {
+							str := attr[start:idx]
+							proc("=\"")
+							proc(str)
+							proc("\"")
+							// skip past trailing double quote and (possible) space
+							idx += 2
+							start = idx
+						} else {
+							idx++
+						}
+					}
+
+					proc("\n")
+					doIndent(depth)
+
+				} else {
+
+					proc(" ")
+					proc(attr)
+				}
+			}
+		}
+
+		// see if suitable for for self-closing tag
+		if curr.Contents == "" && curr.Children == nil {
+			proc("/>")
+			if style != COMPACT {
+				proc("\n")
+			}
+			return
+		}
+
+		proc(">")
+
+		if curr.Contents != "" {
+
+			proc(curr.Contents[:])
+
+		} else {
+
+			if style != COMPACT {
+				proc("\n")
+			}
+
+			for chld := curr.Children; chld != nil; chld = chld.Next {
+				doSubtree(chld, depth+1)
+			}
+
+			if style == INDENT {
+				i := depth
+				for i > 9 {
+					proc("                    ")
+					i -= 10
+				}
+				proc(indentSpaces[i])
+			}
+		}
+
+		proc("<")
+		proc("/")
+		proc(curr.Name)
+		proc(">")
+
+		if style != COMPACT {
+			proc("\n")
+		}
+	}
+
+	doSubtree(node, initial)
+}
+
+// OrderStatistic returns the median, nearest-rank percentile, or most frequent of integer values
+func OrderStatistic(values []int, arg string, status OpType) string {
+
+	if len(values) < 1 {
+		return ""
+	}
+
+	sort.Ints(values)
+	count := len(values)
+
+	switch status {
+	case MED:
+		mid := count / 2
+		if count%2 == 1 {
+			return strconv.Itoa(values[mid])
+		}
+		// even number of values averages the middle two, which may give a fractional result
+		return FormatFloat(float64(values[mid-1]+values[mid]) / 2)
+	case PCT:
+		pct, _ := strconv.Atoi(arg)
+		// smallest value with at least the requested percentage of values at or below it
+		rank := (pct*count + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return strconv.Itoa(values[rank-1])
+	case MODE:
+		// ties are resolved in favor of the smaller value
+		best := values[0]
+		most := 0
+		for i := 0; i < count; {
+			j := i
+			for j < count && values[j] == values[i] {
+				j++
+			}
+			if j-i > most {
+				best = values[i]
+				most = j - i
+			}
+			i = j
+		}
+		return strconv.Itoa(best)
+	default:
+	}
+
+	return ""
+}
+
+// ProcessClause handles comma-separated -element arguments
+func ProcessClause(curr *Node, stages []*Step, mask, prev, pfx, sfx, sep, def, arg string, status OpType, index, level int, variables map[string]string, items *[]string) (string, bool) {
+
+	if curr == nil || stages == nil {
+		return "", false
+	}
+
+	// feature being assembled by -subseq or -translate INSDFeature
+	var feature *Node
+
+	// processElement handles individual -element constructs
+	processElement := func(acc func(string)) {
+
+		if acc == nil {
+			return
+		}
+
+		// element names combined with commas are treated as a prefix-separator-suffix group
+		for _, stage := range stages {
+
+			stat := stage.Type
+			item := stage.Value
+			prnt := stage.Parent
+			match := stage.Match
+			attrib := stage.Attrib
+			wildcard := stage.Wild
+			hops := stage.Hops
+
+			// exploreElements is a wrapper for ExploreElements, obtaining most arguments as closures
+			exploreElements := func(proc func(string, int)) {
+				if hops != nil {
+					ExploreRelatives(curr, hops, prnt, match, attrib, wildcard, level, proc)
+					return
+				}
+				ExploreElements(curr, mask, prnt, match, attrib, wildcard, level, proc)
+			}
+
+			switch stat {
+			case ELEMENT, TERMS, WORDS, PAIRS, LETTERS, INDICES, VALUE, LEN, SUM, MIN, MAX, SUB, AVG, DEV, MED, PCT, MODE,
+				SUBSTR, REPLACE, SPLIT, LPAD, RPAD, TRIM, REVCOMP,
+				COMPOSITION, RESIDUES, GCCONTENT, MOLWT, ISOPOINT, AMBIGUOUS, ACCESSION, LOOKUP:
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						acc(str)
+					}
+				})
+			case TRANSLATE, SUBSEQ, CODONS:
+				if match == "INSDFeature" && prnt == "" && attrib == "" && hops == nil {
+					// assemble feature sequence from parent INSDSeq_sequence and feature intervals
+					ExploreFeatures(curr, match, func(node *Node) {
+						str := FeatureSequence(node)
+						if str != "" {
+							feature = node
+							acc(str)
+							feature = nil
+						}
+					})
+					break
+				}
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						acc(str)
+					}
+				})
+			case FIRST:
+				single := ""
+
+				exploreElements(func(str string, lvl int) {
+					if single == "" {
+						single = str
+					}
+				})
+
+				if single != "" {
+					acc(single)
+				}
+			case LAST:
+				single := ""
+
+				exploreElements(func(str string, lvl int) {
+					single = str
+				})
+
+				if single != "" {
+					acc(single)
+				}
+			case ENCODE:
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						str = html.EscapeString(str)
+						acc(str)
+					}
+				})
+			case UPPER:
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						str = strings.ToUpper(str)
+						acc(str)
+					}
+				})
+			case LOWER:
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						str = strings.ToLower(str)
+						acc(str)
+					}
+				})
+			case TITLE:
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						str = strings.ToLower(str)
+						str = strings.Title(str)
+						acc(str)
+					}
+				})
+			case VARIABLE:
+				// use value of stored variable
+				val, ok := variables[match]
+				if ok {
+					acc(val)
+				}
+			case NUM, COUNT:
+				count := 0
+
+				exploreElements(func(str string, lvl int) {
+					count++
+				})
+
+				// number of element objects
+				val := strconv.Itoa(count)
+				acc(val)
+			case LENGTH:
+				length := 0
+
+				exploreElements(func(str string, lvl int) {
+					length += len(str)
+				})
+
+				// length of element strings
+				val := strconv.Itoa(length)
+				acc(val)
+			case DEPTH:
+				exploreElements(func(str string, lvl int) {
+					// depth of each element in scope
+					val := strconv.Itoa(lvl)
+					acc(val)
+				})
+			case INDEX:
+				// -element "+" prints index of current XML object
+				val := strconv.Itoa(index)
+				acc(val)
+			case INC:
+				// -inc, or component of -0-based, -1-based, or -ucsc-based
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						num, err := strconv.Atoi(str)
+						if err == nil {
+							// increment value
+							num++
+							val := strconv.Itoa(num)
+							acc(val)
+						}
+					}
+				})
+			case DEC:
+				// -dec, or component of -0-based, -1-based, or -ucsc-based
+				exploreElements(func(str string, lvl int) {
+					if str != "" {
+						num, err := strconv.Atoi(str)
+						if err == nil {
+							// decrement value
+							num--
+							val := strconv.Itoa(num)
+							acc(val)
+						}
+					}
+				})
+			case STAR:
+				// -element "*" prints current XML subtree on a single line
+				style := SINGULARITY
+				printAttrs := true
+
+				for _, ch := range item {
+					if ch == '*' {
+						style++
+					} else if ch == '@' {
+						printAttrs = false
+					}
+				}
+				if style > WRAPPED {
+					style = WRAPPED
+				}
+				if style < COMPACT {
+					style = COMPACT
+				}
+
+				var buffer bytes.Buffer
+
+				PrintSubtree(curr, style, printAttrs,
+					func(str string) {
+						if str != "" {
+							buffer.WriteString(str)
+						}
+					})
+
+				txt := buffer.String()
+				if txt != "" {
+					acc(txt)
+				}
+			case DOLLAR:
+				for chld := curr.Children; chld != nil; chld = chld.Next {
+					acc(chld.Name)
+				}
+			case ATSIGN:
+				if curr.Attributes != "" && curr.Attribs == nil {
+					curr.Attribs = ParseAttributes(curr.Attributes)
+				}
+				for i := 0; i < len(curr.Attribs)-1; i += 2 {
+					acc(curr.Attribs[i])
+				}
+			default:
+			}
+		}
+	}
+
+	ok := false
+
+	// format results in buffer
+	var buffer bytes.Buffer
+
+	buffer.WriteString(prev)
+	buffer.WriteString(pfx)
+	between := ""
+
+	// addValue writes a value after the separator, or collects it for -order, -distinct, and -keep
+	addValue := func(str string) {
+		if items != nil {
+			*items = append(*items, str)
+			return
+		}
+		buffer.WriteString(between)
+		buffer.WriteString(str)
+		between = sep
+	}
+
+	switch status {
+	case ELEMENT, ENCODE, UPPER, LOWER, TITLE, VALUE, NUM, INC, DEC, ZEROBASED, ONEBASED, UCSCBASED:
+		processElement(func(str string) {
+			if str != "" {
+				ok = true
+				addValue(str)
+			}
+		})
+	case SUBSTR, REPLACE, SPLIT, LPAD, RPAD, TRIM:
+		processElement(func(str string) {
+			if str != "" {
+				// split can produce several values, other string operations produce one
+				for _, res := range DoStringOperation(str, arg, status) {
+					if res != "" {
+						ok = true
+						addValue(res)
+					}
+				}
+			}
+		})
+	case REVCOMP:
+		processElement(func(str string) {
+			if str != "" {
+				ok = true
+				addValue(ReverseComplement(str))
+			}
+		})
+	case TRANSLATE:
+		processElement(func(str string) {
+			if str != "" {
+				// use qualifiers of assembled feature, otherwise of any feature enclosing current node
+				node := curr
+				if feature != nil {
+					node = feature
+				}
+				gcode, frame, useStart, trimStop := TranslationSettings(node, arg)
+				ok = true
+				addValue(TranslateSequence(str, gcode, frame, useStart, trimStop))
+			}
+		})
+	case CODONS:
+		processElement(func(str string) {
+			if str != "" {
+				// counts are written as GCODE:N,N,...,N for -codon-usage tabulation
+				node := curr
+				if feature != nil {
+					node = feature
+				}
+				gcode, frame, _, _ := TranslationSettings(node, arg)
+				ok = true
+				addValue(FormatCodonCounts(gcode, CodonCounts(str, frame)))
+			}
+		})
+	case ACCESSION:
+		processElement(func(str string) {
+			if str != "" {
+				// prefix, number, version, database, and type, joined by separator
+				for _, fld := range ParseAccession(str) {
+					ok = true
+					addValue(fld)
+				}
+			}
+		})
+	case LOOKUP:
+		processElement(func(str string) {
+			if str != "" {
+				// values without a -lookup entry are skipped, allowing -def to mark them
+				if vals, found := LookupValue(str); found {
+					ok = true
+					addValue(vals)
+				}
+			}
+		})
+	case COMPOSITION, RESIDUES, GCCONTENT, MOLWT, ISOPOINT, AMBIGUOUS:
+		processElement(func(str string) {
+			if str == "" {
+				return
+			}
+			var res []string
+			switch status {
+			case COMPOSITION:
+				// each residue and its count, use -sep "\n" for one residue per line
+				res = SequenceComposition(str)
+			case RESIDUES:
+				// counts of requested residues, in the given order
+				counts := ResidueCounts(str)
+				for _, ch := range strings.ToUpper(arg) {
+					res = append(res, strconv.Itoa(counts[ch]))
+				}
+			case GCCONTENT:
+				if val, ok := GCContent(str); ok {
+					res = append(res, val)
+				}
+			case MOLWT:
+				if val, ok := MolecularWeight(str, SequenceIsProtein(curr, str)); ok {
+					res = append(res, val)
+				}
+			case ISOPOINT:
+				if val, ok := IsoelectricPoint(str); ok {
+					res = append(res, val)
+				}
+			case AMBIGUOUS:
+				res = append(res, strconv.Itoa(AmbiguousBases(str)))
+			}
+			for _, val := range res {
+				ok = true
+				addValue(val)
+			}
+		})
+	case SUBSEQ:
+		processElement(func(str string) {
+			if str != "" {
+				ok = true
+				addValue(str)
+			}
+		})
+	case FIRST:
+		single := ""
+
+		processElement(func(str string) {
+			ok = true
+			if single == "" {
+				single = str
+			}
+		})
+
+		if single != "" {
+			addValue(single)
+		}
+	case LAST:
+		single := ""
+
+		processElement(func(str string) {
+			ok = true
+			single = str
+		})
+
+		if single != "" {
+			addValue(single)
+		}
+	case TERMS:
+		processElement(func(str string) {
+			if str != "" {
+				words := strings.Fields(str)
+				for _, item := range words {
+					max := len(item)
+					for max > 1 {
+						ch := item[max-1]
+						if ch != '.' && ch != ',' && ch != ':' && ch != ';' {
+							break
+						}
+						// trim trailing period, comma, colon, and semicolon
+						item = item[:max-1]
+						// continue checking for runs of punctuation at end
+						max--
+					}
+					ok = true
+					addValue(item)
+				}
+			}
+		})
+	case WORDS:
+		processElement(func(str string) {
+			if str != "" {
+				words := strings.FieldsFunc(str, func(c rune) bool {
+					return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+				})
+				for _, item := range words {
+					item = strings.ToLower(item)
+					ok = true
+					addValue(item)
+				}
+			}
+		})
+	case PAIRS:
+		processElement(func(str string) {
+			if str != "" {
+				words := strings.FieldsFunc(str, func(c rune) bool {
+					return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+				})
+				if len(words) > 1 {
+					past := ""
+					for _, item := range words {
+						item = strings.ToLower(item)
+						plock.RLock()
+						isSW := isStopWord[item]
+						plock.RUnlock()
+						if isSW {
+							past = ""
+							continue
+						}
+						if past != "" {
+							ok = true
+							addValue(past + " " + item)
+						}
+						past = item
+					}
+				}
+			}
+		})
+	case LETTERS:
+		processElement(func(str string) {
+			if str != "" {
+				for _, ch := range str {
+					ok = true
+					addValue(string(ch))
+				}
+			}
+		})
+	case INDICES:
+		var term []string
+		var pair []string
+
+		addToIndex := func(item, past string) string {
+
+			if item == "" {
+				return ""
+			}
+			plock.RLock()
+			isSW := isStopWord[item]
+			plock.RUnlock()
+			if isSW {
+				// skip if stop word, interrupts overlapping word pair chain
+				return ""
+			}
+			ok = true
+			item = html.EscapeString(item)
+			// add single term
+			term = append(term, item)
+			if past != "" {
+				// add informative adjacent word pair
+				pair = append(pair, past+" "+item)
+			}
+
+			return item
+		}
+
+		processElement(func(str string) {
+			if str != "" {
+				if IsNotASCII(str) {
+					str = DoAccentTransform(str)
+				}
+				str = strings.ToLower(str)
+				if HasBadSpace(str) {
+					str = CleanupBadSpaces(str)
+				}
+				if HasMarkup(str) {
+					str = RemoveUnicodeMarkup(str)
+				}
+				if HasAngleBracket(str) {
+					str = DoHTMLReplace(str)
+				}
+
+				// break terms at spaces, allowing hyphenated terms
+				terms := strings.Fields(str)
+				for _, item := range terms {
+					item = html.UnescapeString(item)
+					// allow parentheses in chemical formula
+					item = TrimPunctuation(item)
+					// skip numbers
+					if IsAllNumeric(item) {
+						continue
+					}
+					// index single term
+					addToIndex(item, "")
+				}
+
+				// break words at non-alphanumeric punctuation
+				words := strings.FieldsFunc(str, func(c rune) bool {
+					return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+				})
+				past := ""
+				for _, item := range words {
+					// skip anything starting with a digit
+					if len(item) < 1 || unicode.IsDigit(rune(item[0])) {
+						past = ""
+						continue
+					}
+					// index word and adjacent word pairs
+					past = addToIndex(item, past)
+				}
+			}
+		})
+
+		if ok {
+			// sort arrays of words and pairs
+			sort.Slice(term, func(i, j int) bool { return term[i] < term[j] })
+			sort.Slice(pair, func(i, j int) bool { return pair[i] < pair[j] })
+
+			last := ""
+			for _, item := range term {
+				if item == last {
+					// skip duplicate entry
+					continue
+				}
+				buffer.WriteString("      <NORM>")
+				buffer.WriteString(item)
+				buffer.WriteString("</NORM>\n")
+				last = item
+			}
+
+			last = ""
+			for _, item := range pair {
+				if item == last {
+					// skip duplicate entry
+					continue
+				}
+				buffer.WriteString("      <PAIR>")
+				buffer.WriteString(item)
+				buffer.WriteString("</PAIR>\n")
+				last = item
+			}
+		}
+	case LEN:
+		length := 0
+
+		processElement(func(str string) {
+			ok = true
+			length += len(str)
+		})
+
+		// length of element strings
+		val := strconv.Itoa(length)
+		addValue(val)
+	case SUM:
+		sum := 0
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				sum += value
+				ok = true
+			}
+		})
+
+		if ok {
+			// sum of element values
+			val := strconv.Itoa(sum)
+			addValue(val)
+		}
+	case MIN:
+		min := 0
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				if !ok || value < min {
+					min = value
+				}
+				ok = true
+			}
+		})
+
+		if ok {
+			// minimum of element values
+			val := strconv.Itoa(min)
+			addValue(val)
+		}
+	case MAX:
+		max := 0
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				if !ok || value > max {
+					max = value
+				}
+				ok = true
+			}
+		})
+
+		if ok {
+			// maximum of element values
+			val := strconv.Itoa(max)
+			addValue(val)
+		}
+	case SUB:
+		first := 0
+		second := 0
+		count := 0
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				count++
+				if count == 1 {
+					first = value
+				} else if count == 2 {
+					second = value
+				}
+			}
+		})
+
+		if count == 2 {
+			// must have exactly 2 elements
+			ok = true
+			// difference of element values
+			val := strconv.Itoa(first - second)
+			addValue(val)
+		}
+	case AVG:
+		sum := 0
+		count := 0
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				sum += value
+				count++
+				ok = true
+			}
+		})
+
+		if ok {
+			// average of element values
+			avg := int(float64(sum) / float64(count))
+			val := strconv.Itoa(avg)
+			addValue(val)
+		}
+	case DEV:
+		count := 0
+		mean := 0.0
+		m2 := 0.0
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				// Welford algorithm for one-pass standard deviation
+				count++
+				x := float64(value)
+				delta := x - mean
+				mean += delta / float64(count)
+				m2 += delta * (x - mean)
+			}
+		})
+
+		if count > 1 {
+			// must have at least 2 elements
+			ok = true
+			// standard deviation of element values
+			vrc := m2 / float64(count-1)
+			dev := int(math.Sqrt(vrc))
+			val := strconv.Itoa(dev)
+			addValue(val)
+		}
+	case MED, PCT, MODE:
+		var values []int
+
+		processElement(func(str string) {
+			value, err := strconv.Atoi(str)
+			if err == nil {
+				values = append(values, value)
+				ok = true
+			}
+		})
+
+		if ok {
+			// order statistic of element values
+			val := OrderStatistic(values, arg, status)
+			addValue(val)
+		}
+	default:
+	}
+
+	// use default value if nothing written
+	if !ok && def != "" {
+		ok = true
+		buffer.WriteString(def)
+	}
+
+	buffer.WriteString(sfx)
+
+	if !ok {
+		return "", false
+	}
+
+	txt := buffer.String()
+
+	return txt, true
+}
+
+// ArrangeValues sorts, removes duplicates, and truncates values collected by one extraction command
+func ArrangeValues(items []string, order string, distinct bool, keep string) []string {
+
+	if distinct {
+		seen := make(map[string]bool)
+		uniq := items[:0]
+		for _, str := range items {
+			if !seen[str] {
+				seen[str] = true
+				uniq = append(uniq, str)
+			}
+		}
+		items = uniq
+	}
+
+	switch order {
+	case "asc", "desc":
+		// case-insensitive, with case breaking ties
+		sort.SliceStable(items, func(i, j int) bool {
+			x := strings.ToLower(items[i])
+			y := strings.ToLower(items[j])
+			if x == y {
+				return items[i] < items[j]
+			}
+			return x < y
+		})
+	case "num", "num-desc":
+		// numbers precede non-numeric values, which keep their original order
+		sort.SliceStable(items, func(i, j int) bool {
+			_, x, _, okx := ParseNumber(items[i])
+			_, y, _, oky := ParseNumber(items[j])
+			if okx && oky {
+				if order == "num-desc" {
+					return x > y
+				}
+				return x < y
+			}
+			return okx && !oky
+		})
+	default:
+	}
+
+	if order == "desc" {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	if keep != "" {
+		// -keep N:TEXT adds TEXT only if values were dropped, e.g., "3:et al."
+		num, more := SplitInTwoAt(keep, ":", LEFT)
+		max, _ := strconv.Atoi(num)
+		if max > 0 && len(items) > max {
+			items = items[:max]
+			if more != "" {
+				items = append(items, more)
+			}
+		}
+	}
+
+	return items
+}
+
+// ProcessInstructions performs extraction commands on a subset of XML
+func ProcessInstructions(commands []*Operation, curr *Node, mask, tab, ret string, index, level int, variables map[string]string, accum func(string)) (string, string) {
+
+	if accum == nil {
+		return tab, ret
+	}
+
+	sep := "\t"
+	pfx := ""
+	sfx := ""
+
+	def := ""
+
+	gcode := ""
+	frame := ""
+
+	order := ""
+	distinct := false
+	keep := ""
+
+	col := "\t"
+	lin := "\n"
+
+	varname := ""
+
+	// process commands
+	for _, op := range commands {
+
+		str := op.Value
+
+		switch op.Type {
+		case ELEMENT, FIRST, LAST, ENCODE, UPPER, LOWER, TITLE, TERMS, WORDS, PAIRS, LETTERS, INDICES,
+			NUM, LEN, SUM, MIN, MAX, INC, DEC, SUB, AVG, DEV, MED, PCT, MODE, ZEROBASED, ONEBASED, UCSCBASED,
+			SUBSTR, REPLACE, SPLIT, LPAD, RPAD, TRIM, REVCOMP, TRANSLATE, SUBSEQ,
+			COMPOSITION, RESIDUES, GCCONTENT, MOLWT, ISOPOINT, AMBIGUOUS, CODONS, ACCESSION, LOOKUP:
+			arg := op.Arg
+			if op.Type == TRANSLATE || op.Type == CODONS {
+				arg = gcode + ":" + frame
+			}
+			var txt string
+			var ok bool
+			if order != "" || distinct || keep != "" {
+				// collect values, then rearrange and join with -sep
+				var items []string
+				_, ok = ProcessClause(curr, op.Stages, mask, "", "", "", sep, "", arg, op.Type, index, level, variables, &items)
+				if ok {
+					items = ArrangeValues(items, order, distinct, keep)
+					txt = tab + pfx + strings.Join(items, sep) + sfx
+				} else if def != "" {
+					// use default value if nothing written
+					txt = tab + pfx + def + sfx
+					ok = true
+				}
+			} else {
+				txt, ok = ProcessClause(curr, op.Stages, mask, tab, pfx, sfx, sep, def, arg, op.Type, index, level, variables, nil)
+			}
+			if ok {
+				tab = col
+				ret = lin
+				accum(txt)
+			}
+		case TAB:
+			col = str
+		case RET:
+			lin = str
+		case PFX:
+			pfx = str
+		case SFX:
+			sfx = str
+		case SEP:
+			sep = str
+		case LBL:
+			lbl := str
+			accum(tab)
+			accum(lbl)
+			tab = col
+			ret = lin
+		case PFC:
+			// preface clears previous tab and sets prefix in one command
+			pfx = str
+			fallthrough
+		case CLR:
+			// clear previous tab after the fact
+			tab = ""
+		case RST:
+			pfx = ""
+			sfx = ""
+			sep = "\t"
+			def = ""
+			order = ""
+			distinct = false
+			keep = ""
+		case DEF:
+			def = str
+		case GCODE:
+			gcode = str
+		case FRAME:
+			frame = str
+		case ORDER:
+			order = str
+		case DISTINCT:
+			distinct = true
+		case KEEP:
+			keep = str
+		case VARIABLE:
+			varname = str
+		case VALUE:
+			length := len(str)
+			if length > 1 && str[0] == '(' && str[length-1] == ')' {
+				// set variable from literal text inside parentheses, e.g., -COM "(, )"
+				variables[varname] = str[1 : length-1]
+				// -if "&VARIABLE" will succeed if set to blank with empty parentheses "()"
+			} else if op.Expr != nil {
+				// set variable from arithmetic, comparison, or function expression inside brackets
+				txt, ok := EvaluateExpression(op.Expr, curr, mask, index, level, variables)
+				if ok {
+					variables[varname] = txt
+				} else {
+					delete(variables, varname)
+				}
+			} else if str == "" {
+				// -if "&VARIABLE" will fail if initialized with empty string ""
+				delete(variables, varname)
+			} else {
+				txt, ok := ProcessClause(curr, op.Stages, mask, "", pfx, sfx, sep, def, op.Arg, op.Type, index, level, variables, nil)
+				if ok {
+					variables[varname] = txt
+				}
+			}
+			varname = ""
+		default:
+		}
+	}
+
+	return tab, ret
+}
+
+// CONDITIONAL EXECUTION USES -if AND -unless STATEMENT, WITH SUPPORT FOR DEPRECATED -match AND -avoid STATEMENTS
+
+// ConditionsAreSatisfied tests a set of conditions to determine if extraction should proceed
+func ConditionsAreSatisfied(conditions []*Operation, curr *Node, mask string, index, level int, variables map[string]string) bool {
+
+	if curr == nil {
+		return false
+	}
+
+	required := 0
+	observed := 0
+	forbidden := 0
+	isMatch := false
+	isAvoid := false
+
+	// test string or numeric constraints
+	testConstraint := func(str string, constraint *Step) bool {
+
+		if str == "" || constraint == nil {
+			return false
+		}
+
+		val := constraint.Value
+		stat := constraint.Type
+
+		switch stat {
+		case INLOOKUP:
+			// value must be a key of a -lookup file
+			if _, ok := LookupValue(str); ok {
+				return true
+			}
+		case EQUALS, CONTAINS, STARTSWITH, ENDSWITH, ISNOT:
+			// substring test on element values
+			str = strings.ToUpper(str)
+			val = strings.ToUpper(val)
+
+			switch stat {
+			case EQUALS:
+				if str == val {
+					return true
+				}
+			case CONTAINS:
+				if strings.Contains(str, val) {
+					return true
+				}
+			case STARTSWITH:
+				if strings.HasPrefix(str, val) {
+					return true
+				}
+			case ENDSWITH:
+				if strings.HasSuffix(str, val) {
+					return true
+				}
+			case ISNOT:
+				if str != val {
+					return true
+				}
+			default:
+			}
+		case GT, GE, LT, LE, EQ, NE:
+			// second argument of numeric test can be element specifier
+			if constraint.Parent != "" || constraint.Match != "" || constraint.Attrib != "" || constraint.Hops != nil {
+
+				// exploreConstraint is a wrapper for ExploreElements, obtaining arguments from second element
+				exploreConstraint := func(proc func(string, int)) {
+					if constraint.Hops != nil {
+						ExploreRelatives(curr, constraint.Hops, constraint.Parent, constraint.Match, constraint.Attrib, constraint.Wild, level, proc)
+						return
+					}
+					ExploreElements(curr, mask, constraint.Parent, constraint.Match, constraint.Attrib, constraint.Wild, level, proc)
+				}
+
+				ch := val[0]
+				// pound, percent, and caret prefixes supported as potentially useful for data QA (undocumented)
+				switch ch {
+				case '#':
+					count := 0
+					exploreConstraint(func(stn string, lvl int) {
+						count++
+					})
+					val = strconv.Itoa(count)
+				case '%':
+					length := 0
+					exploreConstraint(func(stn string, lvl int) {
+						if stn != "" {
+							length += len(stn)
+						}
+					})
+					val = strconv.Itoa(length)
+				case '^':
+					depth := 0
+					exploreConstraint(func(stn string, lvl int) {
+						depth = lvl
+					})
+					val = strconv.Itoa(depth)
+				default:
+					exploreConstraint(func(stn string, lvl int) {
+						if stn != "" {
+							_, errz := strconv.Atoi(stn)
+							if errz == nil {
+								val = stn
+							}
+						}
+					})
+				}
+			}
+
+			// numeric tests on element values
+			x, errx := strconv.Atoi(str)
+			y, erry := strconv.Atoi(val)
+
+			// both arguments must resolve to integers
+			if errx != nil || erry != nil {
+				return false
+			}
+
+			switch stat {
+			case GT:
+				if x > y {
+					return true
+				}
+			case GE:
+				if x >= y {
+					return true
+				}
+			case LT:
+				if x < y {
+					return true
+				}
+			case LE:
+				if x <= y {
+					return true
+				}
+			case EQ:
+				if x == y {
+					return true
+				}
+			case NE:
+				if x != y {
+					return true
+				}
+			default:
+			}
+		default:
+		}
+
+		return false
+	}
+
+	// matchFound tests individual conditions
+	matchFound := func(stages []*Step) bool {
+
+		if stages == nil || len(stages) < 1 {
+			return false
+		}
+
+		stage := stages[0]
+
+		var constraint *Step
+
+		if len(stages) > 1 {
+			constraint = stages[1]
+		}
+
+		status := stage.Type
+		prnt := stage.Parent
+		match := stage.Match
+		attrib := stage.Attrib
+		wildcard := stage.Wild
+		hops := stage.Hops
+
+		found := false
+		number := ""
+
+		// exploreElements is a wrapper for ExploreElements, obtaining most arguments as closures
+		exploreElements := func(proc func(string, int)) {
+			if hops != nil {
+				ExploreRelatives(curr, hops, prnt, match, attrib, wildcard, level, proc)
+				return
+			}
+			ExploreElements(curr, mask, prnt, match, attrib, wildcard, level, proc)
+		}
+
+		switch status {
+		case ELEMENT:
+			exploreElements(func(str string, lvl int) {
+				// match to XML container object sends empty string, so do not check for str != "" here
+				// test every selected element individually if value is specified
+				if constraint == nil || testConstraint(str, constraint) {
+					found = true
+				}
+			})
+		case VARIABLE:
+			// use value of stored variable
+			str, ok := variables[match]
+			if ok {
+				//  -if &VARIABLE -equals VALUE is the supported construct
+				if constraint == nil || testConstraint(str, constraint) {
+					found = true
+				}
+			}
+		case COUNT:
+			count := 0
+
+			exploreElements(func(str string, lvl int) {
+				count++
+				found = true
+			})
+
+			// number of element objects
+			number = strconv.Itoa(count)
+		case LENGTH:
+			length := 0
+
+			exploreElements(func(str string, lvl int) {
+				length += len(str)
+				found = true
+			})
+
+			// length of element strings
+			number = strconv.Itoa(length)
+		case DEPTH:
+			depth := 0
+
+			exploreElements(func(str string, lvl int) {
+				depth = lvl
+				found = true
+			})
+
+			// depth of last element in scope
+			number = strconv.Itoa(depth)
+		case INDEX:
+			// index of explored parent object
+			number = strconv.Itoa(index)
+			found = true
+		default:
+		}
+
+		if number == "" {
+			return found
+		}
+
+		if constraint == nil || testConstraint(number, constraint) {
+			return true
+		}
+
+		return false
+	}
+
+	// test conditional arguments
+	for _, op := range conditions {
+
+		switch op.Type {
+		// -if tests for presence of element (deprecated -match can test element:value)
+		case IF, MATCH:
+			// checking for failure here allows for multiple -if [ -and / -or ] clauses
+			if isMatch && observed < required {
+				return false
+			}
+			if isAvoid && forbidden > 0 {
+				return false
+			}
+			required = 0
+			observed = 0
+			forbidden = 0
+			isMatch = true
+			isAvoid = false
+			// continue on to next two cases
+			fallthrough
+		case AND:
+			required++
+			// continue on to next case
+			fallthrough
+		case OR:
+			if matchFound(op.Stages) {
+				observed++
+				// record presence of forbidden element if in -unless clause
+				forbidden++
+			}
+		// -unless tests for absence of element, or presence but with failure of subsequent value test (deprecated -avoid can test element:value)
+		case UNLESS, AVOID:
+			if isMatch && observed < required {
+				return false
+			}
+			if isAvoid && forbidden > 0 {
+				return false
+			}
+			required = 0
+			observed = 0
+			forbidden = 0
+			isMatch = false
+			isAvoid = true
+			if matchFound(op.Stages) {
+				forbidden++
+			}
+		default:
+		}
+	}
+
+	if isMatch && observed < required {
+		return false
+	}
+	if isAvoid && forbidden > 0 {
+		return false
+	}
+
+	return true
+}
+
+// RECURSIVELY PROCESS EXPLORATION COMMANDS AND XML DATA STRUCTURE
+
+// ProcessCommands visits XML nodes, performs conditional tests, and executes data extraction instructions
+func ProcessCommands(cmds *Block, curr *Node, tab, ret string, index, level int, variables map[string]string, accum func(string)) (string, string) {
+
+	if accum == nil {
+		return tab, ret
+	}
+
+	prnt := cmds.Parent
+	match := cmds.Match
+
+	// leading colon indicates namespace prefix wildcard
+	wildcard := false
+	if strings.HasPrefix(prnt, ":") || strings.HasPrefix(match, ":") {
+		wildcard = true
+	}
+
+	// **/Object performs deep exploration of recursive data
+	deep := false
+	if prnt == "**" {
+		prnt = "*"
+		deep = true
+	}
+
+	// closure passes local variables to callback, which can modify caller tab and ret values
+	processNode := func(node *Node, idx, lvl int) {
+
+		// apply -if or -unless tests
+		if ConditionsAreSatisfied(cmds.Conditions, node, match, idx, lvl, variables) {
+
+			// execute data extraction commands
+			if len(cmds.Commands) > 0 {
+				tab, ret = ProcessInstructions(cmds.Commands, node, match, tab, ret, idx, lvl, variables, accum)
+			}
+
+			// process sub commands on child node
+			for _, sub := range cmds.Subtasks {
+				tab, ret = ProcessCommands(sub, node, tab, ret, 1, lvl, variables, accum)
+			}
+
+		} else {
+
+			// execute commands after -else statement
+			if len(cmds.Failure) > 0 {
+				tab, ret = ProcessInstructions(cmds.Failure, node, match, tab, ret, idx, lvl, variables, accum)
+			}
+		}
+	}
+
+	// exploreNodes recursive definition
+	var exploreNodes func(*Node, int, int, func(*Node, int, int)) int
+
+	// exploreNodes visits all nodes that match the selection criteria
+	exploreNodes = func(curr *Node, indx, levl int, proc func(*Node, int, int)) int {
+
+		if curr == nil || proc == nil {
+			return indx
+		}
+
+		// match is "*" for heterogeneous data constructs, e.g., -group PubmedArticleSet/*
+		// wildcard matches any namespace prefix
+		if curr.Name == match ||
+			match == "*" ||
+			(wildcard && strings.HasPrefix(match, ":") && strings.HasSuffix(curr.Name, match)) {
+
+			if prnt == "" ||
+				curr.Parent == prnt ||
+				(wildcard && strings.HasPrefix(prnt, ":") && strings.HasSuffix(curr.Parent, prnt)) {
+
+				proc(curr, indx, levl)
+				indx++
+
+				if !deep {
+					// do not explore within recursive object
+					return indx
+				}
+			}
+		}
+
+		// clearing prnt "*" now allows nested exploration within recursive data, e.g., -pattern Taxon -block */Taxon
+		if prnt == "*" {
+			prnt = ""
+		}
+
+		// explore child nodes
+		for chld := curr.Children; chld != nil; chld = chld.Next {
+			indx = exploreNodes(chld, indx, levl+1, proc)
+		}
+
+		return indx
+	}
+
+	// apply -position test
+
+	if cmds.Position == "" {
+
+		exploreNodes(curr, index, level, processNode)
+
+	} else {
+
+		var single *Node
+		lev := 0
+		ind := 0
+
+		if cmds.Position == "first" {
+
+			exploreNodes(curr, index, level,
+				func(node *Node, idx, lvl int) {
+					if single == nil {
+						single = node
+						ind = idx
+						lev = lvl
+					}
+				})
+
+		} else if cmds.Position == "last" {
+
+			exploreNodes(curr, index, level,
+				func(node *Node, idx, lvl int) {
+					single = node
+					ind = idx
+					lev = lvl
+				})
+
+		} else {
+
+			// use numeric position
+			number, err := strconv.Atoi(cmds.Position)
+			if err == nil {
+
+				pos := 0
+
+				exploreNodes(curr, index, level,
+					func(node *Node, idx, lvl int) {
+						pos++
+						if pos == number {
+							single = node
+							ind = idx
+							lev = lvl
+						}
+					})
+
+			} else {
+
+				fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized position '%s'\n", cmds.Position)
+				os.Exit(1)
+			}
+		}
+
+		if single != nil {
+			processNode(single, ind, lev)
+		}
+	}
+
+	return tab, ret
+}
+
+// PROCESS ONE XML COMPONENT RECORD
+
+// ProcessQuery calls XML combined tokenizer parser on a partitioned string
+func ProcessQuery(Text, parent string, index int, cmds *Block, tbls *Tables, action SpecialType) string {
+
+	str, _, _ := ProcessRecord(Text, parent, index, cmds, tbls, action)
+
+	return str
+}
+
+// ProcessRecord also returns the -unique-by key and -pivot pairs, extracted from the same parsed record
+func ProcessRecord(Text, parent string, index int, cmds *Block, tbls *Tables, action SpecialType) (string, string, string) {
+
+	if Text == "" || tbls == nil {
+		return "", "", ""
+	}
+
+	// node farm variables
+	FarmPos := 0
+	FarmMax := tbls.FarmSize
+	FarmItems := make([]Node, FarmMax)
+
+	// allocate multiple nodes in a large array for memory management efficiency
+	nextNode := func(strt, attr, prnt string) *Node {
+
+		// if farm array slots used up, allocate new array
+		if FarmPos >= FarmMax {
+			FarmItems = make([]Node, FarmMax)
+			FarmPos = 0
+		}
+
+		if FarmItems == nil {
+			return nil
+		}
+
+		// take node from next available slot in farm array
+		node := &FarmItems[FarmPos]
+
+		node.Name = strt[:]
+		node.Attributes = attr[:]
+		node.Parent = prnt[:]
+
+		FarmPos++
+
+		return node
+	}
+
+	// token parser variables
+	Txtlen := len(Text)
+	Idx := 0
+
+	plainText := (!tbls.DoStrict && !tbls.DoMixed)
+
+	// get next XML token
+	nextToken := func(idx int) (TagType, string, string, int) {
+
+		// lookup table array pointers
+		inBlank := &tbls.InBlank
+		inFirst := &tbls.InFirst
+		inElement := &tbls.InElement
+
+		text := Text[:]
+		txtlen := Txtlen
+
+		// XML string ends with > character, acts as sentinel to check if past end of text
+		if idx >= txtlen {
+			// signal end of XML string
+			return ISCLOSED, "", "", 0
+		}
+
+		// skip past leading blanks
+		ch := text[idx]
+		for inBlank[ch] {
+			idx++
+			ch = text[idx]
+		}
+
+		start := idx
+
+		if ch == '<' && (plainText || HTMLAhead(text, idx) == 0) {
+
+			// at start of element
+			idx++
+			ch = text[idx]
+
+			// check for legal first character of element
+			if inFirst[ch] {
+
+				// read element name
+				start = idx
+				idx++
+
+				ch = text[idx]
+				for inElement[ch] {
+					idx++
+					ch = text[idx]
+				}
+
+				str := text[start:idx]
+
+				switch ch {
+				case '>':
+					// end of element
+					idx++
+
+					return STARTTAG, str[:], "", idx
+				case '/':
+					// self-closing element without attributes
+					idx++
+					ch = text[idx]
+					if ch != '>' {
+						fmt.Fprintf(os.Stderr, "\nSelf-closing element missing right angle bracket\n")
+					}
+					idx++
+
+					return SELFTAG, str[:], "", idx
+				case ' ', '\t', '\n', '\r', '\f':
+					// attributes
+					idx++
+					start = idx
+					ch = text[idx]
+					for ch != '<' && ch != '>' {
+						idx++
+						ch = text[idx]
+					}
+					if ch != '>' {
+						fmt.Fprintf(os.Stderr, "\nAttributes not followed by right angle bracket\n")
+					}
+					if text[idx-1] == '/' {
+						// self-closing
+						atr := text[start : idx-1]
+						idx++
+						return SELFTAG, str[:], atr[:], idx
+					}
+					atr := text[start:idx]
+					idx++
+					return STARTTAG, str[:], atr[:], idx
+				default:
+					fmt.Fprintf(os.Stderr, "\nUnexpected punctuation '%c' in XML element\n", ch)
+					return STARTTAG, str[:], "", idx
+				}
+
+			} else {
+
+				// punctuation character immediately after first angle bracket
+				switch ch {
+				case '/':
+					// at start of end tag
+					idx++
+					start = idx
+					ch = text[idx]
+					// expect legal first character of element
+					if inFirst[ch] {
+						idx++
+						ch = text[idx]
+						for inElement[ch] {
+							idx++
+							ch = text[idx]
+						}
+						str := text[start:idx]
+						if ch != '>' {
+							fmt.Fprintf(os.Stderr, "\nUnexpected characters after end element name\n")
+						}
+						idx++
+
+						return STOPTAG, str[:], "", idx
+					}
+					fmt.Fprintf(os.Stderr, "\nUnexpected punctuation '%c' in XML element\n", ch)
+				case '?':
+					// skip ?xml and ?processing instructions
+					idx++
+					ch = text[idx]
+					for ch != '>' {
+						idx++
+						ch = text[idx]
+					}
+					idx++
+				case '!':
+					// skip !DOCTYPE, !comment, and ![CDATA[
+					idx++
+					start = idx
+					ch = text[idx]
+					which := NOTAG
+					skipTo := ""
+					if ch == '[' && strings.HasPrefix(text[idx:], "[CDATA[") {
+						which = CDATATAG
+						skipTo = "]]>"
+						start += 7
+					} else if ch == '-' && strings.HasPrefix(text[idx:], "--") {
+						which = COMMENTTAG
+						skipTo = "-->"
+						start += 2
+					}
+					if which != NOTAG && skipTo != "" {
+						// CDATA or comment block may contain internal angle brackets
+						found := strings.Index(text[idx:], skipTo)
+						if found < 0 {
+							// string stops in middle of CDATA or comment
+							return ISCLOSED, "", "", idx
+						}
+						// adjust position past end of CDATA or comment
+						idx += found + len(skipTo)
+					} else {
+						// otherwise just skip to next right angle bracket
+						for ch != '>' {
+							idx++
+							ch = text[idx]
+						}
+						idx++
+					}
+				default:
+					fmt.Fprintf(os.Stderr, "\nUnexpected punctuation '%c' in XML element\n", ch)
+				}
+			}
+
+		} else if ch != '>' {
+
+			// at start of contents
+			start = idx
+
+			// find end of contents
+			for {
+				for ch != '<' && ch != '>' {
+					idx++
+					ch = text[idx]
+				}
+				if ch == '<' && !plainText {
+					// optionally allow HTML text formatting elements and super/subscripts
+					advance := HTMLAhead(text, idx)
+					if advance > 0 {
+						idx += advance
+						ch = text[idx]
+						continue
+					}
+				}
+				break
+			}
+
+			// trim back past trailing blanks
+			lst := idx - 1
+			ch = text[lst]
+			for inBlank[ch] && lst > start {
+				lst--
+				ch = text[lst]
+			}
+
+			str := text[start : lst+1]
+
+			return CONTENTTAG, str[:], "", idx
+		}
+
+		return NOTAG, "", "", idx
+	}
+
+	// Parse tokens into tree structure for exploration
+
+	// parseLevel recursive definition
+	var parseLevel func(string, string, string) (*Node, bool)
+
+	// parse XML tags into tree structure for searching
+	parseLevel = func(strt, attr, prnt string) (*Node, bool) {
+
+		ok := true
+
+		// obtain next node from farm
+		node := nextNode(strt, attr, prnt)
+		if node == nil {
+			return nil, false
+		}
+
+		var lastNode *Node
+
+		for {
+			tag, name, attr, idx := nextToken(Idx)
+			if tag == ISCLOSED {
+				break
+			}
+			Idx = idx
+
+			switch tag {
+			case STARTTAG:
+				// read sub tree
+				obj, ok := parseLevel(name, attr, node.Name)
+				if !ok {
+					break
+				}
+
+				// upward link supports ancestor and sibling navigation
+				obj.Up = node
+
+				// adding next child to end of linked list gives better performance than appending to slice of nodes
+				if node.Children == nil {
+					node.Children = obj
+				}
+				if lastNode != nil {
+					lastNode.Next = obj
+				}
+				lastNode = obj
+			case STOPTAG:
+				// pop out of recursive call
+				return node, ok
+			case CONTENTTAG:
+				if tbls.DoStrict {
+					if HasMarkup(name) {
+						name = RemoveUnicodeMarkup(name)
+					}
+					if HasAngleBracket(name) {
+						name = DoHTMLReplace(name)
+					}
+				}
+				if tbls.DoMixed {
+					if HasMarkup(name) {
+						name = SimulateUnicodeMarkup(name)
+					}
+					if HasAngleBracket(name) {
+						name = DoHTMLReplace(name)
+					}
+					name = DoTrimFlankingHTML(name)
+				}
+				if tbls.DeAccent {
+					if IsNotASCII(name) {
+						name = DoAccentTransform(name)
+					}
+				}
+				if tbls.DoASCII {
+					if IsNotASCII(name) {
+						name = UnicodeToASCII(name)
+					}
+				}
+				node.Contents = name
+			case SELFTAG:
+				if attr == "" {
+					// ignore if self-closing tag has no attributes
+					continue
+				}
+
+				// self-closing tag has no contents, just create child node
+				obj := nextNode(name, attr, node.Name)
+				obj.Up = node
+
+				if node.Children == nil {
+					node.Children = obj
+				}
+				if lastNode != nil {
+					lastNode.Next = obj
+				}
+				lastNode = obj
+				// continue on same level
+			default:
+			}
+		}
+
+		return node, ok
+	}
+
+	// perform data extraction driven by command-line arguments
+	doQuery := func() (string, string, string) {
+
+		if cmds == nil {
+			return "", "", ""
+		}
+
+		// exit from function will collect garbage of node structure for current XML object
+		tag, name, attr, idx := nextToken(Idx)
+
+		// loop until start tag
+		for {
+			if tag == ISCLOSED {
+				break
+			}
+
+			Idx = idx
+
+			if tag == STARTTAG {
+				break
+			}
+
+			tag, name, attr, idx = nextToken(Idx)
+		}
+
+		pat, ok := parseLevel(name, attr, parent)
+
+		if !ok {
+			return "", "", ""
+		}
+
+		if tbls.OrfElem != "" {
+			// synthesize ORF objects for exploration by -block and testing by -if
+			AddOpenReadingFrames(pat, tbls)
+		}
+
+		// exit from function will also free map of recorded variables for current -pattern
+		variables := make(map[string]string)
+
+		// -persist variables carry over from the previous record
+		persist := len(tbls.Persist) > 0
+		if persist {
+			for _, name := range tbls.Persist {
+				if val, ok := tbls.Persisted[name]; ok {
+					variables[name] = val
+				}
+			}
+		}
+
+		var buffer bytes.Buffer
+
+		ok = false
+
+		if tbls.Hd != "" {
+			buffer.WriteString(tbls.Hd[:])
+		}
+
+		// start processing at top of command tree and top of XML subregion selected by -pattern
+		_, ret := ProcessCommands(cmds, pat, "", "", index, 1, variables,
+			func(str string) {
+				if str != "" {
+					ok = true
+					buffer.WriteString(str)
+				}
+			})
+
+		if persist {
+			// save final values for the next record, a single consumer keeps records in order
+			for _, name := range tbls.Persist {
+				if val, ok := variables[name]; ok {
+					tbls.Persisted[name] = val
+				} else {
+					delete(tbls.Persisted, name)
+				}
+			}
+		}
+
+		if tbls.Tl != "" {
+			buffer.WriteString(tbls.Tl[:])
+		}
+
+		if ret != "" {
+			ok = true
+			buffer.WriteString(ret)
+		}
+
+		txt := buffer.String()
+
+		// remove leading newline (-insd -pfx artifact)
+		if txt != "" && txt[0] == '\n' {
+			txt = txt[1:]
+		}
+
+		// extractBlock runs -unique-by or -pivot commands on the same node tree, without -persist variables
+		extractBlock := func(blk *Block) string {
+			var buf bytes.Buffer
+			_, ret := ProcessCommands(blk, pat, "", "", index, 1, make(map[string]string),
+				func(str string) {
+					buf.WriteString(str)
+				})
+			buf.WriteString(ret)
+			return buf.String()
+		}
+
+		if !ok {
+			// record rejected by -if does not claim its -unique-by key or add -pivot names
+			return "", "", ""
+		}
+
+		pairs := ""
+		if tbls.PivotCmds != nil {
+			pairs = extractBlock(tbls.PivotCmds)
+		}
+
+		key := ""
+		if tbls.UniqueKey != nil {
+			key = strings.TrimSpace(extractBlock(tbls.UniqueKey))
+		}
+
+		// return consolidated result string
+		return txt, key, pairs
+	}
+
+	// Stream tokens to obtain value of single index element
+
+	// parseIndex recursive definition
+	var parseIndex func(string, string, string) string
+
+	// parse XML tags looking for trie index element
+	parseIndex = func(strt, attr, prnt string) string {
+
+		// check for attribute index match
+		if attr != "" && tbls.Attrib != "" && strings.Contains(attr, tbls.Attrib) {
+			if strt == tbls.Match || tbls.Match == "" {
+				if tbls.Parent == "" || prnt == tbls.Parent {
+					attribs := ParseAttributes(attr)
+					for i := 0; i < len(attribs)-1; i += 2 {
+						if attribs[i] == tbls.Attrib {
+							return attribs[i+1]
+						}
+					}
+				}
+			}
+		}
+
+		for {
+			tag, name, attr, idx := nextToken(Idx)
+			if tag == ISCLOSED {
+				break
+			}
+			Idx = idx
+
+			switch tag {
+			case STARTTAG:
+				id := parseIndex(name, attr, strt)
+				if id != "" {
+					return id
+				}
+			case SELFTAG:
+			case STOPTAG:
+				// break recursion
+				return ""
+			case CONTENTTAG:
+				// check for content index match
+				if strt == tbls.Match || tbls.Match == "" {
+					if tbls.Parent == "" || prnt == tbls.Parent {
+						return name
+					}
+				}
+			default:
+			}
+		}
+
+		return ""
+	}
+
+	// just return indexed identifier
+	doIndex := func() string {
+
+		if tbls.Index == "" {
+			return ""
+		}
+
+		tag, name, attr, idx := nextToken(Idx)
+
+		// loop until start tag
+		for {
+			if tag == ISCLOSED {
+				break
+			}
+
+			Idx = idx
+
+			if tag == STARTTAG {
+				break
+			}
+
+			tag, name, attr, idx = nextToken(Idx)
+		}
+
+		return parseIndex(name, attr, parent)
+	}
+
+	// ProcessQuery
+
+	// call specific function
+	switch action {
+	case DOQUERY:
+		return doQuery()
+	case DOINDEX:
+		return doIndex(), "", ""
+	default:
+	}
+
+	return "", "", ""
+}
+
+// CONVERT IDENTIFIER TO DIRECTORY PATH FOR LOCAL FILE ARCHIVE
+
+// MakeArchiveTrie allows a short prefix of letters with an optional underscore, and splits the remainder into character pairs
+func MakeArchiveTrie(str string, arry [132]rune) string {
+
+	if len(str) > 64 {
+		return ""
+	}
+
+	max := 4
+	k := 0
+	for _, ch := range str {
+		if unicode.IsLetter(ch) {
+			k++
+			continue
+		}
+		if ch == '_' {
+			k++
+			max = 6
+		}
+		break
+	}
+
+	// prefix is up to three letters if followed by digits, or up to four letters if followed by an underscore
+	pfx := str[:k]
+	if len(pfx) < max {
+		str = str[k:]
+	} else {
+		pfx = ""
+	}
+
+	i := 0
+
+	if pfx != "" {
+		for _, ch := range pfx {
+			arry[i] = ch
+			i++
+		}
+		arry[i] = '/'
+		i++
+	}
+
+	between := 0
+	doSlash := false
+
+	// remainder is divided in character pairs, e.g., NP_/06/00/51 for NP_060051.2
+	for _, ch := range str {
+		// break at period separating accession from version
+		if ch == '.' {
+			break
+		}
+		if doSlash {
+			arry[i] = '/'
+			i++
+			doSlash = false
+		}
+		arry[i] = ch
+		i++
+		between++
+		if between > 1 {
+			doSlash = true
+			between = 0
+		}
+	}
+
+	return strings.ToUpper(string(arry[:i]))
+}
+
+// CONVERT TERM TO DIRECTORY PATH FOR POSTINGS FILE STORAGE
+
+// MakePostingsTrie splits a string into characters, separated by path delimiting slashes
+func MakePostingsTrie(str string, arry [516]rune) string {
+
+	if len(str) > 256 {
+		return ""
+	}
+
+	i := 0
+	doSlash := false
+	for _, ch := range str {
+		if doSlash {
+			arry[i] = '/'
+			i++
+		}
+		if ch == ' ' {
+			ch = '_'
+		}
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
+			ch = '_'
+		}
+		arry[i] = ch
+		i++
+		doSlash = true
+	}
+
+	return strings.ToLower(string(arry[:i]))
+}
+
+// UNSHUFFLER USES HEAP TO RESTORE OUTPUT OF MULTIPLE CONSUMERS TO ORIGINAL RECORD ORDER
+
+type Extract struct {
+	Index int
+	Ident string
+	Text  string
+}
+
+type ExtractHeap []Extract
+
+// methods that satisfy heap.Interface
+func (h ExtractHeap) Len() int {
+	return len(h)
+}
+func (h ExtractHeap) Less(i, j int) bool {
+	return h[i].Index < h[j].Index
+}
+func (h ExtractHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+func (h *ExtractHeap) Push(x interface{}) {
+	*h = append(*h, x.(Extract))
+}
+func (h *ExtractHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// CONCURRENT CONSUMER GOROUTINES PARSE AND PROCESS PARTITIONED XML OBJECTS
+
+// ReadBlocks -> SplitPattern => StreamTokens => ParseXML => ProcessQuery -> MergeResults
+
+// process with single goroutine calls defer close(out) so consumer(s) can range over channel
+// process with multiple instances calls defer wg.Done(), separate goroutine uses wg.Wait() to delay close(out)
+
+func CreateProducer(pat, star string, rdr *XMLReader, tbls *Tables) <-chan Extract {
+
+	if rdr == nil || tbls == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create producer channel\n")
+		os.Exit(1)
+	}
+
+	// xmlProducer sends partitioned XML strings through channel
+	xmlProducer := func(pat, star string, rdr *XMLReader, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		skip := tbls.RecSkip
+		sample := tbls.RecSample
+
+		// isDone reports that the limiter has written enough results
+		isDone := func() bool {
+			if tbls.RecDone == nil {
+				return false
+			}
+			select {
+			case <-tbls.RecDone:
+				// remainder of current buffer is ignored after reader is closed
+				rdr.Closed = true
+				return true
+			default:
+			}
+			return false
+		}
+
+		if skip == 0 && sample == 0 && tbls.RecDone == nil {
+			// partition all input by pattern and send XML substring to available consumer through channel
+			PartitionPattern(pat, star, rdr,
+				func(rec int, ofs int64, str string) {
+					out <- Extract{rec, "", str}
+				})
+			return
+		}
+
+		// selected records are renumbered consecutively so the unshuffler does not wait for missing indices
+		count := 0
+		seen := 0
+
+		var reservoir []Extract
+		rng := rand.New(rand.NewSource(tbls.RecSeed))
+
+		PartitionPattern(pat, star, rdr,
+			func(rec int, ofs int64, str string) {
+				if rec <= skip || isDone() {
+					return
+				}
+				seen++
+				if sample > 0 {
+					// reservoir sampling keeps each record with equal probability
+					if len(reservoir) < sample {
+						reservoir = append(reservoir, Extract{rec, "", str})
+					} else if j := rng.Intn(seen); j < sample {
+						reservoir[j] = Extract{rec, "", str}
+					}
+					return
+				}
+				count++
+				out <- Extract{count, "", str}
+			})
+
+		// send sampled records in their original order
+		sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].Index < reservoir[j].Index })
+		for _, ext := range reservoir {
+			count++
+			out <- Extract{count, "", ext.Text}
+		}
+	}
+
+	// launch single producer goroutine
+	go xmlProducer(pat, star, rdr, out)
+
+	return out
+}
+
+func CreateUIDReader(in io.Reader, tbls *Tables) <-chan Extract {
+
+	if in == nil || tbls == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create uid reader channel\n")
+		os.Exit(1)
+	}
+
+	// uidReader reads uids from input stream and sends through channel
+	uidReader := func(in io.Reader, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		scanr := bufio.NewScanner(in)
+
+		idx := 0
+		for scanr.Scan() {
+
+			// read lines of identifiers
+			file := scanr.Text()
+			idx++
+
+			out <- Extract{idx, "", file}
+		}
+	}
+
+	// launch single uid reader goroutine
+	go uidReader(in, out)
+
+	return out
+}
+
+func CreateConsumers(cmds *Block, tbls *Tables, parent string, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create consumer channel\n")
+		os.Exit(1)
+	}
+
+	// xmlConsumer reads partitioned XML from channel and calls parser for processing
+	xmlConsumer := func(cmds *Block, tbls *Tables, parent string, wg *sync.WaitGroup, inp <-chan Extract, out chan<- Extract) {
+
+		// report when this consumer has no more records to process
+		defer wg.Done()
+
+		// read partitioned XML from producer channel
+		for ext := range inp {
+
+			idx := ext.Index
+			text := ext.Text
+
+			if text == "" {
+				// should never see empty input data
+				out <- Extract{idx, "", text}
+				continue
+			}
+
+			// -unique-by key and -pivot pairs are extracted in the same pass
+			str, id, pairs := ProcessRecord(text[:], parent, idx, cmds, tbls, DOQUERY)
+
+			// append -pivot name and value pairs after a group separator, empty records stay empty
+			if tbls.PivotCmds != nil && (str != "" || pairs != "") {
+				str += "\x1D" + pairs
+			}
+
+			// send even if empty to get all record counts for reordering
+			out <- Extract{idx, id, str}
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	// launch multiple consumer goroutines
+	for i := 0; i < tbls.NumServe; i++ {
+		wg.Add(1)
+		go xmlConsumer(cmds, tbls, parent, &wg, inp, out)
+	}
+
+	// launch separate anonymous goroutine to wait until all consumers are done
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+func CreateExaminers(tbls *Tables, parent string, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create examiner channel\n")
+		os.Exit(1)
+	}
+
+	// xmlExaminer reads partitioned XML from channel and returns unique identifier
+	xmlExaminer := func(tbls *Tables, wg *sync.WaitGroup, inp <-chan Extract, out chan<- Extract) {
+
+		// report when this examiner has no more records to process
+		defer wg.Done()
+
+		// read partitioned XML from producer channel
+		for ext := range inp {
+
+			idx := ext.Index
+			text := ext.Text
+
+			if text == "" {
+				// should never see empty input data
+				out <- Extract{idx, "", text}
+				continue
+			}
+
+			id := ProcessQuery(text[:], parent, 0, nil, tbls, DOINDEX)
+
+			// send even if empty to get all record counts for reordering
+			out <- Extract{idx, id, text}
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	// launch multiple examiner goroutines
+	for i := 0; i < tbls.NumServe; i++ {
+		wg.Add(1)
+		go xmlExaminer(tbls, &wg, inp, out)
+	}
+
+	// launch separate anonymous goroutine to wait until all examiners are done
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+func CreateUnshuffler(tbls *Tables, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create unshuffler channel\n")
+		os.Exit(1)
+	}
+
+	// xmlUnshuffler restores original order with heap
+	xmlUnshuffler := func(inp <-chan Extract, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		// initialize empty heap
+		hp := &ExtractHeap{}
+		heap.Init(hp)
+
+		// index of next desired result
+		next := 1
+
+		delay := 0
+
+		for ext := range inp {
+
+			// push result onto heap
+			heap.Push(hp, ext)
+
+			// read several values before checking to see if next record to print has been processed
+			if delay < tbls.HeapSize {
+				delay++
+				continue
+			}
+
+			delay = 0
+
+			for hp.Len() > 0 {
+
+				// remove lowest item from heap, use interface type assertion
+				curr := heap.Pop(hp).(Extract)
+
+				if curr.Index > next {
+
+					// record should be printed later, push back onto heap
+					heap.Push(hp, curr)
+					// and go back to waiting on input channel
+					break
+				}
+
+				// send even if empty to get all record counts for reordering
+				out <- Extract{curr.Index, curr.Ident, curr.Text}
+
+				// prevent ambiguous -limit filter from clogging heap (deprecated)
+				if curr.Index == next {
+					// increment index for next expected match
+					next++
+				}
+
+				// keep checking heap to see if next result is already available
+			}
+		}
+
+		// send remainder of heap to output
+		for hp.Len() > 0 {
+			curr := heap.Pop(hp).(Extract)
+
+			out <- Extract{curr.Index, curr.Ident, curr.Text}
+		}
+	}
+
+	// launch single unshuffler goroutine
+	go xmlUnshuffler(inp, out)
+
+	return out
+}
+
+// CreateLimiter passes the first -limit non-empty results, then signals the producer to stop reading
+func CreateLimiter(tbls *Tables, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create limiter channel\n")
+		os.Exit(1)
+	}
+
+	// xmlLimiter counts results in original order
+	xmlLimiter := func(inp <-chan Extract, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		count := 0
+
+		for ext := range inp {
+
+			if count >= tbls.RecLimit {
+				// records already in progress are drained, sending empty result to preserve record count
+				out <- Extract{ext.Index, ext.Ident, ""}
+				continue
+			}
+
+			// -pivot pairs follow a group separator, and only the extracted columns count as a result
+			txt, _ := SplitInTwoAt(ext.Text, "\x1D", LEFT)
+			if txt != "" {
+				count++
+				if count >= tbls.RecLimit && tbls.RecDone != nil {
+					close(tbls.RecDone)
+				}
+			}
+
+			out <- ext
+		}
+	}
+
+	// launch single limiter goroutine
+	go xmlLimiter(inp, out)
+
+	return out
+}
+
+func CreateUniquer(tbls *Tables, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create uniquer channel\n")
+		os.Exit(1)
+	}
+
+	// xmlUniquer removes adjacent records with the same identifier
+	xmlUniquer := func(inp <-chan Extract, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		// remember previous record
+		prev := Extract{}
+
+		for curr := range inp {
+
+			// compare adjacent record identifiers
+			if prev.Text != "" && prev.Ident != curr.Ident {
+
+				// if identifiers are different, send previous to output channel
+				out <- prev
+			}
+
+			// now remember this record
+			prev = curr
+		}
+
+		if prev.Text != "" {
+
+			// send last record
+			out <- prev
+		}
+	}
+
+	// launch single uniquer goroutine
+	go xmlUniquer(inp, out)
+
+	return out
+}
+
+func CreateDeleter(tbls *Tables, dltd string, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create deleter channel\n")
+		os.Exit(1)
+	}
+
+	// map to track UIDs to skip
+	shouldSkip := make(map[string]bool)
+
+	checkMap := false
+
+	if dltd != "" && dltd != "-" {
+		fmt.Fprintf(os.Stderr, "\nEnter CreateDeleter Scanner\n")
+		checkMap = true
+
+		skipFile, err := os.Open(dltd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to read skip file\n")
+			os.Exit(1)
+		}
+
+		scanr := bufio.NewScanner(skipFile)
+
+		for scanr.Scan() {
+
+			// read lines of identifiers
+			id := scanr.Text()
+
+			// add to exclusion map
+			shouldSkip[id] = true
+		}
+
+		skipFile.Close()
+		fmt.Fprintf(os.Stderr, "\nLeave CreateDeleter Scanner\n")
+	}
+
+	// xmlDeleter removes records listed as deleted
+	xmlDeleter := func(inp <-chan Extract, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		for curr := range inp {
+
+			// check if identifier was deleted
+			if checkMap && shouldSkip[curr.Ident] {
+				continue
+			}
+
+			// send to output channel
+			out <- curr
+		}
+	}
+
+	// launch single deleter goroutine
+	go xmlDeleter(inp, out)
+
+	return out
+}
+
+func CreateStashers(tbls *Tables, inp <-chan Extract) <-chan string {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan string, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create stasher channel\n")
+		os.Exit(1)
+	}
+
+	sfx := ".xml"
+	if tbls.Zipp {
+		sfx = ".xml.gz"
+	}
+
+	type StasherType int
+
+	const (
+		OKAY StasherType = iota
+		WAIT
+		BAIL
+	)
+
+	// mutex to protect access to inUse map
+	var flock sync.Mutex
+
+	// map to track files currently being written
+	inUse := make(map[string]int)
+
+	// lockFile function prevents colliding writes
+	lockFile := func(id string, index int) StasherType {
+		// map is non-reentrant, protect with mutex
+		flock.Lock()
+		// multiple return paths, schedule the unlock command up front
+		defer flock.Unlock()
+
+		idx, ok := inUse[id]
+
+		if ok {
+			if idx < index {
+				// later version is being written by another goroutine, skip this
+				return BAIL
+			}
+			// earlier version is being written by another goroutine, wait
+			return WAIT
+		}
+
+		// okay to write file, mark in use to prevent collision
+		inUse[id] = index
+		return OKAY
+	}
+
+	// freeFile function removes entry from inUse map
+	freeFile := func(id string) {
+		flock.Lock()
+		// free entry in map, later versions of same record can now be written
+		delete(inUse, id)
+		flock.Unlock()
+	}
+
+	// trimLeft function reformats output, efficiently skipping leading spaces on each line
+	trimLeft := func(text string) string {
+
+		if text == "" {
+			return ""
+		}
+
+		var buffer bytes.Buffer
+
+		max := len(text)
+		idx := 0
+		inBlank := &tbls.InBlank
+
+		for idx < max {
+
+			// skip past leading blanks and empty lines
+			for idx < max {
+				ch := text[idx]
+				if !inBlank[ch] {
+					break
+				}
+				idx++
+			}
+
+			start := idx
+
+			// skip to next newline
+			for idx < max {
+				if text[idx] == '\n' {
+					break
+				}
+				idx++
+			}
+
+			str := text[start:idx]
+
+			if str == "" {
+				continue
+			}
+
+			// skip processing instruction
+			if strings.HasPrefix(str, "<?") && strings.HasSuffix(str, "?>") {
+				continue
+			}
+
+			// trim spaces next to angle bracket
+			str = strings.Replace(str, "> ", ">", -1)
+			str = strings.Replace(str, " <", "<", -1)
+
+			buffer.WriteString(str[:])
+			buffer.WriteString("\n")
+		}
+
+		return buffer.String()
+	}
+
+	// stashRecord saves individual XML record to archive file accessed by trie
+	stashRecord := func(text, id string, index int) string {
+
+		var arry [132]rune
+		trie := MakeArchiveTrie(id, arry)
+		if trie == "" {
+			return ""
+		}
+
+		attempts := 5
+		keepChecking := true
+
+		for keepChecking {
+			// check if file is not being written by another goroutine
+			switch lockFile(id, index) {
+			case OKAY:
+				// okay to save this record now
+				keepChecking = false
+			case WAIT:
+				// earlier version is being saved, wait one second and try again
+				time.Sleep(time.Second)
+				attempts--
+				if attempts < 1 {
+					// cannot get lock after several attempts
+					fmt.Fprintf(os.Stderr, "\nERROR: Unable to save '%s'\n", id)
+					return ""
+				}
+			case BAIL:
+				// later version is being saved, skip this one
+				return ""
+			default:
+			}
+		}
+
+		// delete lock after writing file
+		defer freeFile(id)
+
+		dpath := path.Join(tbls.Stash, trie)
+		if dpath == "" {
+			return ""
+		}
+		_, err := os.Stat(dpath)
+		if err != nil && os.IsNotExist(err) {
+			err = os.MkdirAll(dpath, os.ModePerm)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			return ""
+		}
+		fpath := path.Join(dpath, id+sfx)
+		if fpath == "" {
+			return ""
+		}
+
+		// overwrites and truncates existing file
+		fl, err := os.Create(fpath)
+		if err != nil {
+			fmt.Println(err.Error())
+			return ""
+		}
+
+		// remove leading spaces on each line
+		str := trimLeft(text)
+
+		res := ""
+
+		if tbls.Hash {
+			// calculate hash code for verification table
+			hsh := crc32.NewIEEE()
+			hsh.Write([]byte(str))
+			val := hsh.Sum32()
+			res = strconv.FormatUint(uint64(val), 10)
+		}
+
+		if tbls.Zipp {
+
+			zpr, err := gzip.NewWriterLevel(fl, gzip.BestCompression)
+
+			if err == nil {
+				bfr := bufio.NewWriter(zpr)
+
+				// compress and copy record to file
+				bfr.WriteString(str)
+				if !strings.HasSuffix(str, "\n") {
+					bfr.WriteString("\n")
+				}
+				bfr.Flush()
+			}
+
+			zpr.Close()
+
+		} else {
+
+			// copy record to file
+			fl.WriteString(str)
+			if !strings.HasSuffix(str, "\n") {
+				fl.WriteString("\n")
+			}
+		}
+
+		err = fl.Sync()
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fl.Close()
+
+		return res
+	}
+
+	// xmlStasher reads from channel and calls stashRecord
+	xmlStasher := func(wg *sync.WaitGroup, inp <-chan Extract, out chan<- string) {
+
+		defer wg.Done()
+
+		for ext := range inp {
+
+			hsh := stashRecord(ext.Text, ext.Ident, ext.Index)
+			res := ext.Ident
+			if tbls.Hash {
+				res += "\t" + hsh
+			}
+			res += "\n"
+
+			out <- res
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	// launch multiple stasher goroutines
+	for i := 0; i < tbls.NumServe; i++ {
+		wg.Add(1)
+		go xmlStasher(&wg, inp, out)
+	}
+
+	// launch separate anonymous goroutine to wait until all stashers are done
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+func CreateFetchers(tbls *Tables, inp <-chan Extract) <-chan Extract {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create fetcher channel\n")
+		os.Exit(1)
+	}
+
+	sfx := ".xml"
+	if tbls.Zipp {
+		sfx = ".xml.gz"
+	}
+
+	// xmlFetcher reads XML from file
+	xmlFetcher := func(tbls *Tables, wg *sync.WaitGroup, inp <-chan Extract, out chan<- Extract) {
+
+		// report when more records to process
+		defer wg.Done()
+
+		var buf bytes.Buffer
+
+		for ext := range inp {
+
+			idx := ext.Index
+			file := ext.Text
+
+			var arry [132]rune
+			trie := MakeArchiveTrie(file, arry)
+			if trie == "" {
+				continue
+			}
+
+			fpath := path.Join(tbls.Stash, trie, file+sfx)
+			if fpath == "" {
+				continue
+			}
+
+			iszip := tbls.Zipp
+
+			inFile, err := os.Open(fpath)
+
+			// if failed to find ".xml" file, try ".xml.gz" without requiring -gzip
+			if err != nil && os.IsNotExist(err) && !tbls.Zipp {
+				iszip = true
+				fpath := path.Join(tbls.Stash, trie, file+".xml.gz")
+				if fpath == "" {
+					continue
+				}
+				inFile, err = os.Open(fpath)
+			}
+			if err != nil {
+				continue
+			}
+
+			buf.Reset()
+
+			brd := bufio.NewReader(inFile)
+
+			if iszip {
+
+				zpr, err := gzip.NewReader(brd)
+
+				if err == nil {
+					// copy and decompress cached file contents
+					buf.ReadFrom(zpr)
+				}
+
+				zpr.Close()
+
+			} else {
+
+				// copy cached file contents
+				buf.ReadFrom(brd)
+			}
+
+			inFile.Close()
+
+			str := buf.String()
+
+			out <- Extract{idx, "", str}
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	// launch multiple fetcher goroutines
+	for i := 0; i < tbls.NumServe; i++ {
+		wg.Add(1)
+		go xmlFetcher(tbls, &wg, inp, out)
+	}
+
+	// launch separate anonymous goroutine to wait until all fetchers are done
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+func CreateTermListReader(in io.Reader, tbls *Tables) <-chan Extract {
+
+	if in == nil || tbls == nil {
+		return nil
+	}
+
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create term list reader channel\n")
+		os.Exit(1)
+	}
+
+	// termReader reads uids and terms from input stream and sends through channel
+	termReader := func(in io.Reader, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		var buffer bytes.Buffer
+
+		uid := ""
+		term := ""
+		prev := ""
+		count := 0
+
+		scanr := bufio.NewScanner(in)
+
+		idx := 0
+		for scanr.Scan() {
+
+			// read lines of uid and term groups
+			line := scanr.Text()
+			idx++
+
+			uid, term = SplitInTwoAt(line, "\t", LEFT)
+
+			if prev != "" && prev != term {
+
+				str := buffer.String()
+				out <- Extract{idx, prev, str}
+
+				buffer.Reset()
+				count = 0
+			}
+
+			buffer.WriteString(uid)
+			buffer.WriteString("\n")
+			count++
+
+			prev = term
+		}
+
+		if count > 0 {
+
+			str := buffer.String()
+			out <- Extract{idx, term, str}
+
+			buffer.Reset()
+		}
+	}
+
+	// launch single term reader goroutine
+	go termReader(in, out)
+
+	return out
+}
+
+func CreatePosters(tbls *Tables, inp <-chan Extract) <-chan string {
+
+	if tbls == nil || inp == nil {
+		return nil
+	}
+
+	out := make(chan string, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create poster channel\n")
+		os.Exit(1)
+	}
+
+	// savePosting writes individual postings list to file accessed by radix trie
+	savePosting := func(text, id string, index int) {
+
+		var arry [516]rune
+		trie := MakePostingsTrie(id, arry)
+		if trie == "" {
+			return
+		}
+
+		dpath := path.Join(tbls.Posting, trie)
+		if dpath == "" {
+			return
+		}
+		_, err := os.Stat(dpath)
+		if err != nil && os.IsNotExist(err) {
+			err = os.MkdirAll(dpath, os.ModePerm)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fpath := path.Join(dpath, "uids.txt")
+		if fpath == "" {
+			return
+		}
+
+		// appends if file exists, otherwise creates
+		fl, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fl.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			fl.WriteString("\n")
+		}
+
+		err = fl.Sync()
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fl.Close()
+	}
+
+	// xmlPoster reads from channel and calls savePosting
+	xmlPoster := func(wg *sync.WaitGroup, inp <-chan Extract, out chan<- string) {
+
+		defer wg.Done()
+
+		for ext := range inp {
+
+			savePosting(ext.Text, ext.Ident, ext.Index)
+
+			out <- ext.Ident
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	// launch multiple poster goroutines
+	for i := 0; i < tbls.NumServe; i++ {
+		wg.Add(1)
+		go xmlPoster(&wg, inp, out)
+	}
+
+	// launch separate anonymous goroutine to wait until all posters are done
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// ASN.1 VALUE NOTATION CONVERTER
+
+type AsnKind int
+
+const (
+	_ AsnKind = iota
+	ASNSTRING
+	ASNNUMBER
+	ASNHEX
+	ASNIDENT
+	ASNCHOICE
+	ASNBLOCK
+)
+
+type AsnItem struct {
+	Name  string
+	Value *AsnValue
+}
+
+type AsnValue struct {
+	Kind  AsnKind
+	Text  string
+	Child *AsnValue
+	Items []AsnItem
+}
+
+// asnTypeIs gives the named type of a member, keyed by Type.member, for NCBI-XML element names,
+// "Type*" is a SEQUENCE OF that type, "*" is a SEQUENCE OF a primitive type, members not listed are inline types
+var asnTypeIs = map[string]string{
+	"Entrezgene-Set":                  "Entrezgene*",
+	"Entrezgene.track-info":           "Gene-track",
+	"Entrezgene.source":               "BioSource",
+	"Entrezgene.gene":                 "Gene-ref",
+	"Entrezgene.prot":                 "Prot-ref",
+	"Entrezgene.rna":                  "RNA-ref",
+	"Entrezgene.location":             "Maps*",
+	"Entrezgene.gene-source":          "Gene-source",
+	"Entrezgene.locus":                "Gene-commentary*",
+	"Entrezgene.properties":           "Gene-commentary*",
+	"Entrezgene.refgene":              "Gene-commentary*",
+	"Entrezgene.homology":             "Gene-commentary*",
+	"Entrezgene.comments":             "Gene-commentary*",
+	"Entrezgene.unique-keys":          "Dbtag*",
+	"Entrezgene.xtra-index-terms":     "*",
+	"Entrezgene.xtra-properties":      "Xtra-Terms*",
+	"Entrezgene.xtra-iq":              "Xtra-Terms*",
+	"Entrezgene.non-unique-keys":      "Dbtag*",
+	"Gene-track.current-id":           "Dbtag*",
+	"Gene-track.create-date":          "Date",
+	"Gene-track.update-date":          "Date",
+	"Gene-track.discontinue-date":     "Date",
+	"Gene-commentary.xtra-properties": "Xtra-Terms*",
+	"Gene-commentary.refs":            "Pub*",
+	"Gene-commentary.source":          "Other-source*",
+	"Gene-commentary.genomic-coords":  "Seq-loc*",
+	"Gene-commentary.seqs":            "Seq-loc*",
+	"Gene-commentary.products":        "Gene-commentary*",
+	"Gene-commentary.properties":      "Gene-commentary*",
+	"Gene-commentary.comment":         "Gene-commentary*",
+	"Gene-commentary.create-date":     "Date",
+	"Gene-commentary.update-date":     "Date",
+	"Gene-commentary.rna":             "RNA-ref",
+	"Other-source.src":                "Dbtag",
+	"Gene-ref.db":                     "Dbtag*",
+	"Gene-ref.syn":                    "*",
+	"Gene-ref.formal-name":            "Gene-nomenclature",
+	"Gene-nomenclature.source":        "Dbtag",
+	"Prot-ref.name":                   "*",
+	"Prot-ref.ec":                     "*",
+	"Prot-ref.activity":               "*",
+	"Prot-ref.db":                     "Dbtag*",
+	"BioSource.org":                   "Org-ref",
+	"BioSource.subtype":               "SubSource*",
+	"Org-ref.mod":                     "*",
+	"Org-ref.db":                      "Dbtag*",
+	"Org-ref.syn":                     "*",
+	"Org-ref.orgname":                 "OrgName",
+	"OrgName.mod":                     "OrgMod*",
+	"OrgName_name.binomial":           "BinomialOrgName",
+	"Dbtag.tag":                       "Object-id",
+	"Date.std":                        "Date-std",
+	"Pub.pmid":                        "PubMedId",
+	"Pub-equiv":                       "Pub*",
+	"Pubdesc.pub":                     "Pub-equiv",
+	"Seq-entry.seq":                   "Bioseq",
+	"Seq-entry.set":                   "Bioseq-set",
+	"Bioseq-set.id":                   "Object-id",
+	"Bioseq-set.date":                 "Date",
+	"Bioseq-set.descr":                "Seq-descr",
+	"Bioseq-set.seq-set":              "Seq-entry*",
+	"Bioseq-set.annot":                "Seq-annot*",
+	"Bioseq.id":                       "Seq-id*",
+	"Bioseq.descr":                    "Seq-descr",
+	"Bioseq.inst":                     "Seq-inst",
+	"Bioseq.annot":                    "Seq-annot*",
+	"Seq-descr":                       "Seqdesc*",
+	"Seqdesc.source":                  "BioSource",
+	"Seqdesc.molinfo":                 "MolInfo",
+	"Seqdesc.pub":                     "Pubdesc",
+	"Seqdesc.create-date":             "Date",
+	"Seqdesc.update-date":             "Date",
+	"Seq-inst.seq-data":               "Seq-data",
+	"Seq-data.iupacna":                "IUPACna",
+	"Seq-data.iupacaa":                "IUPACaa",
+	"Seq-data.ncbi2na":                "NCBI2na",
+	"Seq-data.ncbi4na":                "NCBI4na",
+	"Seq-data.ncbi8na":                "NCBI8na",
+	"Seq-data.ncbi8aa":                "NCBI8aa",
+	"Seq-data.ncbieaa":                "NCBIeaa",
+	"Seq-data.ncbistdaa":              "NCBIstdaa",
+	"Seq-annot_data.ftable":           "Seq-feat*",
+	"Seq-feat.id":                     "Feat-id",
+	"Seq-feat.data":                   "SeqFeatData",
+	"Seq-feat.product":                "Seq-loc",
+	"Seq-feat.location":               "Seq-loc",
+	"Seq-feat.qual":                   "Gb-qual*",
+	"Seq-feat.dbxref":                 "Dbtag*",
+	"Feat-id.local":                   "Object-id",
+	"SeqFeatData.gene":                "Gene-ref",
+	"SeqFeatData.org":                 "Org-ref",
+	"SeqFeatData.cdregion":            "Cdregion",
+	"SeqFeatData.prot":                "Prot-ref",
+	"SeqFeatData.rna":                 "RNA-ref",
+	"SeqFeatData.pub":                 "Pubdesc",
+	"SeqFeatData.biosrc":              "BioSource",
+	"Cdregion.code":                   "Genetic-code",
+	"Genetic-code":                    "*",
+	"Seq-loc.empty":                   "Seq-id",
+	"Seq-loc.whole":                   "Seq-id",
+	"Seq-loc.int":                     "Seq-interval",
+	"Seq-loc.packed-int":              "Packed-seqint",
+	"Seq-loc.pnt":                     "Seq-point",
+	"Seq-loc.mix":                     "Seq-loc-mix",
+	"Seq-loc.equiv":                   "Seq-loc-equiv",
+	"Packed-seqint":                   "Seq-interval*",
+	"Seq-loc-mix":                     "Seq-loc*",
+	"Seq-loc-equiv":                   "Seq-loc*",
+	"Seq-interval.id":                 "Seq-id",
+	"Seq-interval.strand":             "Na-strand",
+	"Seq-interval.fuzz-from":          "Int-fuzz",
+	"Seq-interval.fuzz-to":            "Int-fuzz",
+	"Seq-point.id":                    "Seq-id",
+	"Seq-point.strand":                "Na-strand",
+	"Seq-point.fuzz":                  "Int-fuzz",
+	"Seq-id.local":                    "Object-id",
+	"Seq-id.genbank":                  "Textseq-id",
+	"Seq-id.embl":                     "Textseq-id",
+	"Seq-id.ddbj":                     "Textseq-id",
+	"Seq-id.pir":                      "Textseq-id",
+	"Seq-id.swissprot":                "Textseq-id",
+	"Seq-id.prf":                      "Textseq-id",
+	"Seq-id.other":                    "Textseq-id",
+	"Seq-id.tpg":                      "Textseq-id",
+	"Seq-id.tpe":                      "Textseq-id",
+	"Seq-id.tpd":                      "Textseq-id",
+	"Seq-id.gpipe":                    "Textseq-id",
+	"Seq-id.named-annot-track":        "Textseq-id",
+	"Seq-id.general":                  "Dbtag",
+	"Seq-id.pdb":                      "PDB-seq-id",
+}
+
+// AsnTokenizer returns ASN.1 value notation tokens, with strings marked by a leading quote
+type AsnTokenizer struct {
+	Reader *bufio.Reader
+	Line   int
+	Peeked string
+	IsPeek bool
+}
+
+// Next returns the next token, or an empty string at end of input
+func (tkz *AsnTokenizer) Next() string {
+
+	if tkz.IsPeek {
+		tkz.IsPeek = false
+		return tkz.Peeked
+	}
+
+	rdr := tkz.Reader
+
+	for {
+		ch, _, err := rdr.ReadRune()
+		if err != nil {
+			return ""
+		}
+
+		switch {
+		case ch == '\n':
+			tkz.Line++
+		case unicode.IsSpace(ch):
+		case ch == '{' || ch == '}' || ch == ',':
+			return string(ch)
+		case ch == ':':
+			// assignment operator
+			rdr.ReadRune()
+			rdr.ReadRune()
+			return "::="
+		case ch == '-':
+			nxt, _, _ := rdr.ReadRune()
+			if nxt == '-' {
+				// comment runs to next double hyphen or end of line
+				prev := ' '
+				for {
+					ch, _, err = rdr.ReadRune()
+					if err != nil || ch == '\n' || (ch == '-' && prev == '-') {
+						break
+					}
+					prev = ch
+				}
+				if ch == '\n' {
+					tkz.Line++
+				}
+				continue
+			}
+			rdr.UnreadRune()
+			return "-" + tkz.readWord()
+		case ch == '"':
+			var buffer bytes.Buffer
+			buffer.WriteString("\"")
+			for {
+				ch, _, err = rdr.ReadRune()
+				if err != nil {
+					break
+				}
+				if ch == '"' {
+					// doubled quote is an embedded quote
+					nxt, _, _ := rdr.ReadRune()
+					if nxt != '"' {
+						rdr.UnreadRune()
+						break
+					}
+				}
+				if ch == '\n' {
+					// long strings are wrapped across lines
+					tkz.Line++
+					continue
+				}
+				if ch == '\r' {
+					continue
+				}
+				buffer.WriteRune(ch)
+			}
+			return buffer.String()
+		case ch == '\'':
+			var buffer bytes.Buffer
+			buffer.WriteString("'")
+			for {
+				ch, _, err = rdr.ReadRune()
+				if err != nil || ch == '\'' {
+					break
+				}
+				if ch == '\n' {
+					tkz.Line++
+				}
+				if !unicode.IsSpace(ch) {
+					buffer.WriteRune(ch)
 				}
-				buffer.WriteString("      <PAIR>")
-				buffer.WriteString(item)
-				buffer.WriteString("</PAIR>\n")
-				last = item
 			}
+			// skip H or B suffix
+			rdr.ReadRune()
+			return buffer.String()
+		default:
+			rdr.UnreadRune()
+			return tkz.readWord()
 		}
-	case LEN:
-		length := 0
-
-		processElement(func(str string) {
-			ok = true
-			length += len(str)
-		})
+	}
+}
 
-		// length of element strings
-		val := strconv.Itoa(length)
-		buffer.WriteString(between)
-		buffer.WriteString(val)
-		between = sep
-	case SUM:
-		sum := 0
+// readWord collects an identifier or number
+func (tkz *AsnTokenizer) readWord() string {
 
-		processElement(func(str string) {
-			value, err := strconv.Atoi(str)
-			if err == nil {
-				sum += value
-				ok = true
-			}
-		})
+	var buffer bytes.Buffer
 
-		if ok {
-			// sum of element values
-			val := strconv.Itoa(sum)
-			buffer.WriteString(between)
-			buffer.WriteString(val)
-			between = sep
+	for {
+		ch, _, err := tkz.Reader.ReadRune()
+		if err != nil {
+			break
 		}
-	case MIN:
-		min := 0
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '-' && ch != '_' && ch != '.' {
+			tkz.Reader.UnreadRune()
+			break
+		}
+		buffer.WriteRune(ch)
+	}
 
-		processElement(func(str string) {
-			value, err := strconv.Atoi(str)
-			if err == nil {
-				if !ok || value < min {
-					min = value
-				}
-				ok = true
-			}
-		})
+	if buffer.Len() == 0 {
+		// consume unexpected character so the parser can report it
+		ch, _, _ := tkz.Reader.ReadRune()
+		buffer.WriteRune(ch)
+	}
 
-		if ok {
-			// minimum of element values
-			val := strconv.Itoa(min)
-			buffer.WriteString(between)
-			buffer.WriteString(val)
-			between = sep
-		}
-	case MAX:
-		max := 0
+	return buffer.String()
+}
 
-		processElement(func(str string) {
-			value, err := strconv.Atoi(str)
-			if err == nil {
-				if !ok || value > max {
-					max = value
-				}
-				ok = true
-			}
-		})
+// Peek returns the next token without consuming it
+func (tkz *AsnTokenizer) Peek() string {
 
-		if ok {
-			// maximum of element values
-			val := strconv.Itoa(max)
-			buffer.WriteString(between)
-			buffer.WriteString(val)
-			between = sep
-		}
-	case SUB:
-		first := 0
-		second := 0
-		count := 0
+	if !tkz.IsPeek {
+		tkz.Peeked = tkz.Next()
+		tkz.IsPeek = true
+	}
 
-		processElement(func(str string) {
-			value, err := strconv.Atoi(str)
-			if err == nil {
-				count++
-				if count == 1 {
-					first = value
-				} else if count == 2 {
-					second = value
-				}
-			}
-		})
+	return tkz.Peeked
+}
 
-		if count == 2 {
-			// must have exactly 2 elements
-			ok = true
-			// difference of element values
-			val := strconv.Itoa(first - second)
-			buffer.WriteString(between)
-			buffer.WriteString(val)
-			between = sep
-		}
-	case AVG:
-		sum := 0
-		count := 0
+// ParseAsnValue reads a string, number, hex string, enumerated identifier, CHOICE alternative, or braced list
+func ParseAsnValue(tkz *AsnTokenizer) *AsnValue {
 
-		processElement(func(str string) {
-			value, err := strconv.Atoi(str)
-			if err == nil {
-				sum += value
-				count++
-				ok = true
-			}
-		})
+	fail := func(tkn string) {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unexpected '%s' in ASN.1 input at line %d\n", tkn, tkz.Line+1)
+		os.Exit(1)
+	}
 
-		if ok {
-			// average of element values
-			avg := int(float64(sum) / float64(count))
-			val := strconv.Itoa(avg)
-			buffer.WriteString(between)
-			buffer.WriteString(val)
-			between = sep
-		}
-	case DEV:
-		count := 0
-		mean := 0.0
-		m2 := 0.0
+	tkn := tkz.Next()
 
-		processElement(func(str string) {
-			value, err := strconv.Atoi(str)
-			if err == nil {
-				// Welford algorithm for one-pass standard deviation
-				count++
-				x := float64(value)
-				delta := x - mean
-				mean += delta / float64(count)
-				m2 += delta * (x - mean)
+	switch {
+	case tkn == "":
+		fail("end of file")
+	case tkn == "{":
+		val := &AsnValue{Kind: ASNBLOCK}
+		if tkz.Peek() == "}" {
+			tkz.Next()
+			return val
+		}
+		for {
+			// item is a named member or CHOICE alternative followed by its value, or an unnamed value
+			item := AsnItem{}
+			nxt := tkz.Peek()
+			if IsAsnIdentifier(nxt) {
+				tkz.Next()
+				after := tkz.Peek()
+				if after == "," || after == "}" {
+					item.Value = &AsnValue{Kind: ASNIDENT, Text: nxt}
+				} else {
+					item.Name = nxt
+					item.Value = ParseAsnValue(tkz)
+				}
+			} else {
+				item.Value = ParseAsnValue(tkz)
+			}
+			val.Items = append(val.Items, item)
+			tkn = tkz.Next()
+			if tkn == "}" {
+				break
+			}
+			if tkn != "," {
+				fail(tkn)
 			}
-		})
-
-		if count > 1 {
-			// must have at least 2 elements
-			ok = true
-			// standard deviation of element values
-			vrc := m2 / float64(count-1)
-			dev := int(math.Sqrt(vrc))
-			val := strconv.Itoa(dev)
-			buffer.WriteString(between)
-			buffer.WriteString(val)
-			between = sep
 		}
+		return val
+	case tkn[0] == '"':
+		return &AsnValue{Kind: ASNSTRING, Text: tkn[1:]}
+	case tkn[0] == '\'':
+		return &AsnValue{Kind: ASNHEX, Text: tkn[1:]}
+	case tkn[0] == '-' || unicode.IsDigit(rune(tkn[0])):
+		return &AsnValue{Kind: ASNNUMBER, Text: tkn}
+	case IsAsnIdentifier(tkn):
+		nxt := tkz.Peek()
+		if nxt == "," || nxt == "}" || nxt == "" || IsAsnTypeName(nxt) {
+			return &AsnValue{Kind: ASNIDENT, Text: tkn}
+		}
+		return &AsnValue{Kind: ASNCHOICE, Text: tkn, Child: ParseAsnValue(tkz)}
 	default:
+		fail(tkn)
 	}
 
-	// use default value if nothing written
-	if !ok && def != "" {
-		ok = true
-		buffer.WriteString(def)
+	return nil
+}
+
+// IsAsnIdentifier is true for member names and enumerated values, which start with a lower-case letter
+func IsAsnIdentifier(tkn string) bool {
+
+	if tkn == "" {
+		return false
 	}
 
-	buffer.WriteString(sfx)
+	ch := rune(tkn[0])
+	if unicode.IsLower(ch) {
+		return true
+	}
 
-	if !ok {
-		return "", false
+	// boolean and null values are upper-case keywords
+	return tkn == "TRUE" || tkn == "FALSE" || tkn == "NULL"
+}
+
+// IsAsnTypeName is true for type names, which start with an upper-case letter
+func IsAsnTypeName(tkn string) bool {
+
+	return tkn != "" && unicode.IsUpper(rune(tkn[0])) && tkn != "TRUE" && tkn != "FALSE" && tkn != "NULL"
+}
+
+// WriteAsnValue writes an XML element for an ASN.1 value, using NCBI-XML naming conventions
+func WriteAsnValue(wrtr *bufio.Writer, elem, desc string, val *AsnValue) {
+
+	if val == nil {
+		return
 	}
 
-	txt := buffer.String()
+	rplcr := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
 
-	return txt, true
+	if desc == "" {
+		// named list types, e.g., Seq-descr, are described by their own entry
+		desc = asnTypeIs[elem]
+	}
+
+	switch val.Kind {
+	case ASNIDENT:
+		if desc != "" && !strings.HasSuffix(desc, "*") {
+			// named enumerated type, e.g., Na-strand
+			fmt.Fprintf(wrtr, "<%s>\n", elem)
+			WriteAsnValue(wrtr, desc, "", val)
+			fmt.Fprintf(wrtr, "</%s>\n", elem)
+			return
+		}
+		switch val.Text {
+		case "NULL":
+			fmt.Fprintf(wrtr, "<%s/>\n", elem)
+		case "TRUE", "FALSE":
+			fmt.Fprintf(wrtr, "<%s value=\"%s\"/>\n", elem, strings.ToLower(val.Text))
+		default:
+			fmt.Fprintf(wrtr, "<%s value=\"%s\"/>\n", elem, val.Text)
+		}
+		return
+	case ASNSTRING, ASNNUMBER, ASNHEX:
+		txt := rplcr.Replace(val.Text)
+		if desc != "" && !strings.HasSuffix(desc, "*") {
+			// named primitive type, e.g., PubMedId or IUPACna
+			fmt.Fprintf(wrtr, "<%s><%s>%s</%s></%s>\n", elem, desc, txt, desc, elem)
+		} else {
+			fmt.Fprintf(wrtr, "<%s>%s</%s>\n", elem, txt, elem)
+		}
+		return
+	default:
+	}
+
+	fmt.Fprintf(wrtr, "<%s>\n", elem)
+
+	switch {
+	case desc == "*":
+		// SEQUENCE OF primitive or inline type uses _E suffix
+		for _, item := range val.Items {
+			WriteAsnValue(wrtr, elem+"_E", "", AsnItemValue(item))
+		}
+	case strings.HasSuffix(desc, "*"):
+		// SEQUENCE OF named type
+		typ := strings.TrimSuffix(desc, "*")
+		for _, item := range val.Items {
+			WriteAsnValue(wrtr, typ, "", AsnItemValue(item))
+		}
+	case desc != "":
+		// member of named type encloses element of that type
+		WriteAsnValue(wrtr, desc, "", val)
+	case val.Kind == ASNCHOICE:
+		WriteAsnValue(wrtr, elem+"_"+val.Text, asnTypeIs[elem+"."+val.Text], val.Child)
+	default:
+		for _, item := range val.Items {
+			if item.Name == "" {
+				WriteAsnValue(wrtr, elem+"_E", "", item.Value)
+				continue
+			}
+			WriteAsnValue(wrtr, elem+"_"+item.Name, asnTypeIs[elem+"."+item.Name], item.Value)
+		}
+	}
+
+	fmt.Fprintf(wrtr, "</%s>\n", elem)
 }
 
-// ProcessInstructions performs extraction commands on a subset of XML
-func ProcessInstructions(commands []*Operation, curr *Node, mask, tab, ret string, index, level int, variables map[string]string, accum func(string)) (string, string) {
+// AsnItemValue converts a named list item back into a CHOICE value
+func AsnItemValue(item AsnItem) *AsnValue {
 
-	if accum == nil {
-		return tab, ret
+	if item.Name == "" {
+		return item.Value
 	}
 
-	sep := "\t"
-	pfx := ""
-	sfx := ""
+	return &AsnValue{Kind: ASNCHOICE, Text: item.Name, Child: item.Value}
+}
 
-	def := ""
+// ConvertASN translates a stream of "Type ::= value" objects to XML, read concurrently through a pipe
+func ConvertASN(in io.Reader) io.Reader {
 
-	col := "\t"
-	lin := "\n"
+	pr, pw := io.Pipe()
 
-	varname := ""
+	go func() {
 
-	// process commands
-	for _, op := range commands {
+		wrtr := bufio.NewWriter(pw)
 
-		str := op.Value
+		tkz := &AsnTokenizer{Reader: bufio.NewReader(in)}
 
-		switch op.Type {
-		case ELEMENT, FIRST, LAST, ENCODE, UPPER, LOWER, TITLE, TERMS, WORDS, PAIRS, LETTERS, INDICES,
-			NUM, LEN, SUM, MIN, MAX, INC, DEC, SUB, AVG, DEV, ZEROBASED, ONEBASED, UCSCBASED:
-			txt, ok := ProcessClause(curr, op.Stages, mask, tab, pfx, sfx, sep, def, op.Type, index, level, variables)
-			if ok {
-				tab = col
-				ret = lin
-				accum(txt)
-			}
-		case TAB:
-			col = str
-		case RET:
-			lin = str
-		case PFX:
-			pfx = str
-		case SFX:
-			sfx = str
-		case SEP:
-			sep = str
-		case LBL:
-			lbl := str
-			accum(tab)
-			accum(lbl)
-			tab = col
-			ret = lin
-		case PFC:
-			// preface clears previous tab and sets prefix in one command
-			pfx = str
-			fallthrough
-		case CLR:
-			// clear previous tab after the fact
-			tab = ""
-		case RST:
-			pfx = ""
-			sfx = ""
-			sep = "\t"
-			def = ""
-		case DEF:
-			def = str
-		case VARIABLE:
-			varname = str
-		case VALUE:
-			length := len(str)
-			if length > 1 && str[0] == '(' && str[length-1] == ')' {
-				// set variable from literal text inside parentheses, e.g., -COM "(, )"
-				variables[varname] = str[1 : length-1]
-				// -if "&VARIABLE" will succeed if set to blank with empty parentheses "()"
-			} else if str == "" {
-				// -if "&VARIABLE" will fail if initialized with empty string ""
-				delete(variables, varname)
-			} else {
-				txt, ok := ProcessClause(curr, op.Stages, mask, "", pfx, sfx, sep, def, op.Type, index, level, variables)
-				if ok {
-					variables[varname] = txt
-				}
+		for {
+			name := tkz.Next()
+			if name == "" {
+				break
 			}
-			varname = ""
-		default:
+			if tkz.Next() != "::=" {
+				fmt.Fprintf(os.Stderr, "\nERROR: Missing ::= after '%s' in ASN.1 input at line %d\n", name, tkz.Line+1)
+				os.Exit(1)
+			}
+
+			WriteAsnValue(wrtr, name, "", ParseAsnValue(tkz))
 		}
-	}
 
-	return tab, ret
+		wrtr.Flush()
+		pw.Close()
+	}()
+
+	return pr
 }
 
-// CONDITIONAL EXECUTION USES -if AND -unless STATEMENT, WITH SUPPORT FOR DEPRECATED -match AND -avoid STATEMENTS
+// IsASNInput peeks at the start of input for a "Type ::=" assignment instead of an XML tag
+func IsASNInput(brd *bufio.Reader) bool {
 
-// ConditionsAreSatisfied tests a set of conditions to determine if extraction should proceed
-func ConditionsAreSatisfied(conditions []*Operation, curr *Node, mask string, index, level int, variables map[string]string) bool {
+	buf, _ := brd.Peek(4096)
+	str := strings.TrimSpace(string(buf))
 
-	if curr == nil {
+	if str == "" || strings.HasPrefix(str, "<") {
 		return false
 	}
 
-	required := 0
-	observed := 0
-	forbidden := 0
-	isMatch := false
-	isAvoid := false
+	pos := strings.Index(str, "::=")
+	if pos < 1 {
+		return false
+	}
 
-	// test string or numeric constraints
-	testConstraint := func(str string, constraint *Step) bool {
+	return IsAsnTypeName(strings.TrimSpace(str[:pos]))
+}
 
-		if str == "" || constraint == nil {
-			return false
-		}
+// INTERVAL SET OPERATIONS
 
-		val := constraint.Value
-		stat := constraint.Type
+type Interval struct {
+	Chr   string
+	Start int
+	Stop  int
+	Line  string
+}
 
-		switch stat {
-		case EQUALS, CONTAINS, STARTSWITH, ENDSWITH, ISNOT:
-			// substring test on element values
-			str = strings.ToUpper(str)
-			val = strings.ToUpper(val)
+// IntervalSet keeps intervals sorted by start position on each chromosome, with running maximum of stop positions
+type IntervalSet struct {
+	Ranges  map[string][]Interval
+	MaxStop map[string][]int
+}
 
-			switch stat {
-			case EQUALS:
-				if str == val {
-					return true
-				}
-			case CONTAINS:
-				if strings.Contains(str, val) {
-					return true
-				}
-			case STARTSWITH:
-				if strings.HasPrefix(str, val) {
-					return true
-				}
-			case ENDSWITH:
-				if strings.HasSuffix(str, val) {
-					return true
-				}
-			case ISNOT:
-				if str != val {
-					return true
-				}
-			default:
-			}
-		case GT, GE, LT, LE, EQ, NE:
-			// second argument of numeric test can be element specifier
-			if constraint.Parent != "" || constraint.Match != "" || constraint.Attrib != "" {
-				ch := val[0]
-				// pound, percent, and caret prefixes supported as potentially useful for data QA (undocumented)
-				switch ch {
-				case '#':
-					count := 0
-					ExploreElements(curr, mask, constraint.Parent, constraint.Match, constraint.Attrib, constraint.Wild, level, func(stn string, lvl int) {
-						count++
-					})
-					val = strconv.Itoa(count)
-				case '%':
-					length := 0
-					ExploreElements(curr, mask, constraint.Parent, constraint.Match, constraint.Attrib, constraint.Wild, level, func(stn string, lvl int) {
-						if stn != "" {
-							length += len(stn)
-						}
-					})
-					val = strconv.Itoa(length)
-				case '^':
-					depth := 0
-					ExploreElements(curr, mask, constraint.Parent, constraint.Match, constraint.Attrib, constraint.Wild, level, func(stn string, lvl int) {
-						depth = lvl
-					})
-					val = strconv.Itoa(depth)
-				default:
-					ExploreElements(curr, mask, constraint.Parent, constraint.Match, constraint.Attrib, constraint.Wild, level, func(stn string, lvl int) {
-						if stn != "" {
-							_, errz := strconv.Atoi(stn)
-							if errz == nil {
-								val = stn
-							}
-						}
-					})
-				}
-			}
+// ParseInterval reads chromosome, start, and stop from the first three columns, swapping minus strand positions
+func ParseInterval(line string) (Interval, bool) {
 
-			// numeric tests on element values
-			x, errx := strconv.Atoi(str)
-			y, erry := strconv.Atoi(val)
+	cols := strings.SplitN(line, "\t", 4)
+	if len(cols) < 3 || strings.HasPrefix(line, "#") {
+		return Interval{}, false
+	}
 
-			// both arguments must resolve to integers
-			if errx != nil || erry != nil {
-				return false
-			}
+	start, err := strconv.Atoi(strings.TrimSpace(cols[1]))
+	if err != nil {
+		return Interval{}, false
+	}
+	stop, err := strconv.Atoi(strings.TrimSpace(cols[2]))
+	if err != nil {
+		return Interval{}, false
+	}
+	if start > stop {
+		start, stop = stop, start
+	}
 
-			switch stat {
-			case GT:
-				if x > y {
-					return true
-				}
-			case GE:
-				if x >= y {
-					return true
-				}
-			case LT:
-				if x < y {
-					return true
-				}
-			case LE:
-				if x <= y {
-					return true
-				}
-			case EQ:
-				if x == y {
-					return true
-				}
-			case NE:
-				if x != y {
-					return true
-				}
-			default:
+	return Interval{Chr: cols[0], Start: start, Stop: stop, Line: line}, true
+}
+
+// ReadIntervalFile loads a second interval set for overlap, subtract, and nearest queries
+func ReadIntervalFile(fileName string) *IntervalSet {
+
+	inFile, err := os.Open(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to open interval file '%s'\n", fileName)
+		os.Exit(1)
+	}
+	defer inFile.Close()
+
+	set := &IntervalSet{Ranges: make(map[string][]Interval), MaxStop: make(map[string][]int)}
+
+	scanr := bufio.NewScanner(inFile)
+	// allow long rows with many additional columns
+	scanr.Buffer(make([]byte, 65536), 16777216)
+
+	for scanr.Scan() {
+		intv, ok := ParseInterval(scanr.Text())
+		if ok {
+			set.Ranges[intv.Chr] = append(set.Ranges[intv.Chr], intv)
+		}
+	}
+
+	if err := scanr.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to read interval file '%s'\n", fileName)
+		os.Exit(1)
+	}
+
+	for chr, ranges := range set.Ranges {
+		sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+		// running maximum allows early exit when scanning backward for overlaps
+		maxStop := make([]int, len(ranges))
+		for i, intv := range ranges {
+			maxStop[i] = intv.Stop
+			if i > 0 && maxStop[i-1] > intv.Stop {
+				maxStop[i] = maxStop[i-1]
 			}
-		default:
 		}
+		set.MaxStop[chr] = maxStop
+	}
 
-		return false
+	return set
+}
+
+// Overlapping returns intervals on the same chromosome that share at least one position, in start order
+func (set *IntervalSet) Overlapping(qry Interval) []Interval {
+
+	ranges := set.Ranges[qry.Chr]
+	maxStop := set.MaxStop[qry.Chr]
+
+	// index of first interval starting after query
+	k := sort.Search(len(ranges), func(i int) bool { return ranges[i].Start > qry.Stop })
+
+	var res []Interval
+	for i := k - 1; i >= 0 && maxStop[i] >= qry.Start; i-- {
+		if ranges[i].Stop >= qry.Start {
+			res = append(res, ranges[i])
+		}
 	}
 
-	// matchFound tests individual conditions
-	matchFound := func(stages []*Step) bool {
+	// reverse to restore start order
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
 
-		if stages == nil || len(stages) < 1 {
-			return false
+	return res
+}
+
+// Nearest returns overlapping intervals at distance 0, otherwise the closest upstream or downstream intervals
+func (set *IntervalSet) Nearest(qry Interval) ([]Interval, int) {
+
+	if res := set.Overlapping(qry); len(res) > 0 {
+		return res, 0
+	}
+
+	ranges := set.Ranges[qry.Chr]
+	maxStop := set.MaxStop[qry.Chr]
+	if len(ranges) == 0 {
+		return nil, -1
+	}
+
+	var res []Interval
+	best := -1
+
+	// closest interval ending before query has the maximum stop among those starting before it
+	k := sort.Search(len(ranges), func(i int) bool { return ranges[i].Start > qry.Stop })
+	if k > 0 {
+		limit := maxStop[k-1]
+		best = qry.Start - limit
+		for i := k - 1; i >= 0 && maxStop[i] >= limit; i-- {
+			if ranges[i].Stop == limit {
+				res = append(res, ranges[i])
+			}
 		}
+	}
 
-		stage := stages[0]
+	// closest interval starting after query
+	if k < len(ranges) {
+		dist := ranges[k].Start - qry.Stop
+		if best < 0 || dist < best {
+			res = nil
+			best = dist
+		}
+		if dist == best {
+			for i := k; i < len(ranges) && ranges[i].Start == ranges[k].Start; i++ {
+				res = append(res, ranges[i])
+			}
+		}
+	}
 
-		var constraint *Step
+	return res, best
+}
 
-		if len(stages) > 1 {
-			constraint = stages[1]
+// ProcessIntervals performs merge, overlap, subtract, or nearest operations on tab-delimited chromosome ranges
+func ProcessIntervals(in io.Reader, args []string) {
+
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "\nERROR: Operation missing after -intervals command\n")
+		os.Exit(1)
+	}
+
+	oper := args[0]
+
+	var set *IntervalSet
+
+	switch oper {
+	case "merge":
+	case "overlap", "subtract", "nearest":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "\nERROR: Interval file missing after -intervals %s\n", oper)
+			os.Exit(1)
 		}
+		set = ReadIntervalFile(args[1])
+	default:
+		fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized -intervals operation '%s'\n", oper)
+		os.Exit(1)
+	}
 
-		status := stage.Type
-		prnt := stage.Parent
-		match := stage.Match
-		attrib := stage.Attrib
-		wildcard := stage.Wild
+	wrtr := bufio.NewWriter(os.Stdout)
+	defer wrtr.Flush()
 
-		found := false
-		number := ""
+	scanr := bufio.NewScanner(in)
+	scanr.Buffer(make([]byte, 65536), 16777216)
 
-		// exploreElements is a wrapper for ExploreElements, obtaining most arguments as closures
-		exploreElements := func(proc func(string, int)) {
-			ExploreElements(curr, mask, prnt, match, attrib, wildcard, level, proc)
+	// checkScan reports lines too long for the scanner instead of silently truncating input
+	checkScan := func() {
+		if err := scanr.Err(); err != nil {
+			wrtr.Flush()
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to read intervals, %s\n", err.Error())
+			os.Exit(1)
 		}
+	}
 
-		switch status {
-		case ELEMENT:
-			exploreElements(func(str string, lvl int) {
-				// match to XML container object sends empty string, so do not check for str != "" here
-				// test every selected element individually if value is specified
-				if constraint == nil || testConstraint(str, constraint) {
-					found = true
-				}
-			})
-		case VARIABLE:
-			// use value of stored variable
-			str, ok := variables[match]
-			if ok {
-				//  -if &VARIABLE -equals VALUE is the supported construct
-				if constraint == nil || testConstraint(str, constraint) {
-					found = true
-				}
+	if oper == "merge" {
+
+		// load all intervals, keeping chromosomes in order of first appearance
+		var order []string
+		ranges := make(map[string][]Interval)
+		for scanr.Scan() {
+			intv, ok := ParseInterval(scanr.Text())
+			if !ok {
+				continue
 			}
-		case COUNT:
-			count := 0
+			if _, found := ranges[intv.Chr]; !found {
+				order = append(order, intv.Chr)
+			}
+			ranges[intv.Chr] = append(ranges[intv.Chr], intv)
+		}
+		checkScan()
 
-			exploreElements(func(str string, lvl int) {
-				count++
-				found = true
-			})
+		for _, chr := range order {
+			items := ranges[chr]
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Start < items[j].Start })
 
-			// number of element objects
-			number = strconv.Itoa(count)
-		case LENGTH:
-			length := 0
+			// combine overlapping or adjacent intervals, reporting number of members
+			curr := items[0]
+			count := 1
+			for _, intv := range items[1:] {
+				if intv.Start <= curr.Stop+1 {
+					if intv.Stop > curr.Stop {
+						curr.Stop = intv.Stop
+					}
+					count++
+					continue
+				}
+				fmt.Fprintf(wrtr, "%s\t%d\t%d\t%d\n", chr, curr.Start, curr.Stop, count)
+				curr = intv
+				count = 1
+			}
+			fmt.Fprintf(wrtr, "%s\t%d\t%d\t%d\n", chr, curr.Start, curr.Stop, count)
+		}
 
-			exploreElements(func(str string, lvl int) {
-				length += len(str)
-				found = true
-			})
+		return
+	}
 
-			// length of element strings
-			number = strconv.Itoa(length)
-		case DEPTH:
-			depth := 0
+	// stream query intervals in original order
+	for scanr.Scan() {
 
-			exploreElements(func(str string, lvl int) {
-				depth = lvl
-				found = true
-			})
+		line := scanr.Text()
+		qry, ok := ParseInterval(line)
+		if !ok {
+			continue
+		}
 
-			// depth of last element in scope
-			number = strconv.Itoa(depth)
-		case INDEX:
-			// index of explored parent object
-			number = strconv.Itoa(index)
-			found = true
+		switch oper {
+		case "overlap":
+			for _, intv := range set.Overlapping(qry) {
+				fmt.Fprintf(wrtr, "%s\t%s\n", line, intv.Line)
+			}
+		case "nearest":
+			res, dist := set.Nearest(qry)
+			for _, intv := range res {
+				fmt.Fprintf(wrtr, "%s\t%s\t%d\n", line, intv.Line, dist)
+			}
+		case "subtract":
+			// remaining pieces keep any additional columns of the query
+			extra := ""
+			cols := strings.SplitN(line, "\t", 4)
+			if len(cols) > 3 {
+				extra = "\t" + cols[3]
+			}
+			start := qry.Start
+			for _, intv := range set.Overlapping(qry) {
+				if intv.Start > start {
+					fmt.Fprintf(wrtr, "%s\t%d\t%d%s\n", qry.Chr, start, intv.Start-1, extra)
+				}
+				if intv.Stop+1 > start {
+					start = intv.Stop + 1
+				}
+			}
+			if start <= qry.Stop {
+				fmt.Fprintf(wrtr, "%s\t%d\t%d%s\n", qry.Chr, start, qry.Stop, extra)
+			}
 		default:
 		}
+	}
+	checkScan()
+}
 
-		if number == "" {
-			return found
-		}
+// EXTERNAL RECORD SORT
 
-		if constraint == nil || testConstraint(number, constraint) {
-			return true
-		}
+// NaturalLess compares keys with runs of digits ordered by numeric value, so 9 sorts before 10
+func NaturalLess(a, b string) bool {
 
-		return false
+	isDigit := func(ch byte) bool {
+		return ch >= '0' && ch <= '9'
 	}
 
-	// test conditional arguments
-	for _, op := range conditions {
-
-		switch op.Type {
-		// -if tests for presence of element (deprecated -match can test element:value)
-		case IF, MATCH:
-			// checking for failure here allows for multiple -if [ -and / -or ] clauses
-			if isMatch && observed < required {
-				return false
-			}
-			if isAvoid && forbidden > 0 {
-				return false
-			}
-			required = 0
-			observed = 0
-			forbidden = 0
-			isMatch = true
-			isAvoid = false
-			// continue on to next two cases
-			fallthrough
-		case AND:
-			required++
-			// continue on to next case
-			fallthrough
-		case OR:
-			if matchFound(op.Stages) {
-				observed++
-				// record presence of forbidden element if in -unless clause
-				forbidden++
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			// compare digit runs ignoring leading zeros, first by length, then lexically
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
 			}
-		// -unless tests for absence of element, or presence but with failure of subsequent value test (deprecated -avoid can test element:value)
-		case UNLESS, AVOID:
-			if isMatch && observed < required {
-				return false
+			for j < len(b) && isDigit(b[j]) {
+				j++
 			}
-			if isAvoid && forbidden > 0 {
-				return false
+			x := strings.TrimLeft(a[si:i], "0")
+			y := strings.TrimLeft(b[sj:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
 			}
-			required = 0
-			observed = 0
-			forbidden = 0
-			isMatch = false
-			isAvoid = true
-			if matchFound(op.Stages) {
-				forbidden++
+			if x != y {
+				return x < y
 			}
-		default:
+			continue
 		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
 	}
 
-	if isMatch && observed < required {
+	return len(a)-i < len(b)-j
+}
+
+// sortedBefore orders records by key, with missing keys last and original position breaking ties
+func sortedBefore(x, y Extract) bool {
+
+	if x.Ident != y.Ident {
+		if x.Ident == "" {
+			return false
+		}
+		if y.Ident == "" {
+			return true
+		}
+		if NaturalLess(x.Ident, y.Ident) {
+			return true
+		}
+		if NaturalLess(y.Ident, x.Ident) {
+			return false
+		}
+	}
+
+	return x.Index < y.Index
+}
+
+// SortRun is a temporary file of records in key order, with the next unmerged record
+type SortRun struct {
+	Name   string
+	File   *os.File
+	Reader *bufio.Reader
+	Curr   Extract
+}
+
+// maxMergeRuns limits the number of run files open at once, well below the usual descriptor limit
+const maxMergeRuns = 64
+
+// next reads the following record of a run, returning false at the end of the file
+func (run *SortRun) next() bool {
+
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(run.Reader, hdr); err != nil {
 		return false
 	}
-	if isAvoid && forbidden > 0 {
+
+	key := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+	txt := make([]byte, binary.BigEndian.Uint32(hdr[12:]))
+	if _, err := io.ReadFull(run.Reader, key); err != nil {
+		return false
+	}
+	if _, err := io.ReadFull(run.Reader, txt); err != nil {
 		return false
 	}
 
+	run.Curr = Extract{int(binary.BigEndian.Uint64(hdr)), string(key), string(txt)}
+
 	return true
 }
 
-// RECURSIVELY PROCESS EXPLORATION COMMANDS AND XML DATA STRUCTURE
-
-// ProcessCommands visits XML nodes, performs conditional tests, and executes data extraction instructions
-func ProcessCommands(cmds *Block, curr *Node, tab, ret string, index, level int, variables map[string]string, accum func(string)) (string, string) {
+type SortRunHeap []*SortRun
 
-	if accum == nil {
-		return tab, ret
-	}
+// methods that satisfy heap.Interface
+func (h SortRunHeap) Len() int {
+	return len(h)
+}
+func (h SortRunHeap) Less(i, j int) bool {
+	return sortedBefore(h[i].Curr, h[j].Curr)
+}
+func (h SortRunHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+func (h *SortRunHeap) Push(x interface{}) {
+	*h = append(*h, x.(*SortRun))
+}
+func (h *SortRunHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
 
-	prnt := cmds.Parent
-	match := cmds.Match
+// CreateRecordSorter orders records by -sort-by key, writing sorted runs to temporary files when memory is full
+func CreateRecordSorter(tbls *Tables, inp <-chan Extract, limit int) <-chan Extract {
 
-	// leading colon indicates namespace prefix wildcard
-	wildcard := false
-	if strings.HasPrefix(prnt, ":") || strings.HasPrefix(match, ":") {
-		wildcard = true
+	if tbls == nil || inp == nil {
+		return nil
 	}
 
-	// **/Object performs deep exploration of recursive data
-	deep := false
-	if prnt == "**" {
-		prnt = "*"
-		deep = true
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create record sorter channel\n")
+		os.Exit(1)
 	}
 
-	// closure passes local variables to callback, which can modify caller tab and ret values
-	processNode := func(node *Node, idx, lvl int) {
+	// xmlSorter collects records, then merges sorted runs
+	xmlSorter := func(inp <-chan Extract, out chan<- Extract) {
 
-		// apply -if or -unless tests
-		if ConditionsAreSatisfied(cmds.Conditions, node, match, idx, lvl, variables) {
+		// close channel when all records have been processed
+		defer close(out)
 
-			// execute data extraction commands
-			if len(cmds.Commands) > 0 {
-				tab, ret = ProcessInstructions(cmds.Commands, node, match, tab, ret, idx, lvl, variables, accum)
+		var recs []Extract
+		var runs []*SortRun
+		size := 0
+
+		defer func() {
+			for _, run := range runs {
+				os.Remove(run.Name)
 			}
+		}()
 
-			// process sub commands on child node
-			for _, sub := range cmds.Subtasks {
-				tab, ret = ProcessCommands(sub, node, tab, ret, 1, lvl, variables, accum)
+		// newRun creates a temporary file, which is closed after writing so idle runs hold no descriptors
+		newRun := func() (*SortRun, *os.File, *bufio.Writer) {
+			file, err := ioutil.TempFile("", "xtract-sort-")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unable to create sort run file\n")
+				os.Exit(1)
 			}
+			return &SortRun{Name: file.Name()}, file, bufio.NewWriter(file)
+		}
 
-		} else {
+		// writeRecord saves a record as index, key length, and text length, followed by key and text
+		hdr := make([]byte, 16)
+		writeRecord := func(wrtr *bufio.Writer, ext Extract) {
+			binary.BigEndian.PutUint64(hdr, uint64(ext.Index))
+			binary.BigEndian.PutUint32(hdr[8:], uint32(len(ext.Ident)))
+			binary.BigEndian.PutUint32(hdr[12:], uint32(len(ext.Text)))
+			wrtr.Write(hdr)
+			wrtr.WriteString(ext.Ident)
+			wrtr.WriteString(ext.Text)
+		}
 
-			// execute commands after -else statement
-			if len(cmds.Failure) > 0 {
-				tab, ret = ProcessInstructions(cmds.Failure, node, match, tab, ret, idx, lvl, variables, accum)
+		closeRun := func(file *os.File, wrtr *bufio.Writer) {
+			if wrtr.Flush() != nil || file.Close() != nil {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unable to write sort run file\n")
+				os.Exit(1)
 			}
 		}
-	}
 
-	// exploreNodes recursive definition
-	var exploreNodes func(*Node, int, int, func(*Node, int, int)) int
+		// writeRun saves sorted records from memory
+		writeRun := func() {
 
-	// exploreNodes visits all nodes that match the selection criteria
-	exploreNodes = func(curr *Node, indx, levl int, proc func(*Node, int, int)) int {
+			run, file, wrtr := newRun()
+			for _, ext := range recs {
+				writeRecord(wrtr, ext)
+			}
+			closeRun(file, wrtr)
+			runs = append(runs, run)
 
-		if curr == nil || proc == nil {
-			return indx
+			recs = nil
+			size = 0
 		}
 
-		// match is "*" for heterogeneous data constructs, e.g., -group PubmedArticleSet/*
-		// wildcard matches any namespace prefix
-		if curr.Name == match ||
-			match == "*" ||
-			(wildcard && strings.HasPrefix(match, ":") && strings.HasSuffix(curr.Name, match)) {
-
-			if prnt == "" ||
-				curr.Parent == prnt ||
-				(wildcard && strings.HasPrefix(prnt, ":") && strings.HasSuffix(curr.Parent, prnt)) {
+		// mergeRuns is a k-way merge of sorted runs
+		mergeRuns := func(group []*SortRun, proc func(Extract)) {
 
-				proc(curr, indx, levl)
-				indx++
+			hp := &SortRunHeap{}
+			heap.Init(hp)
 
-				if !deep {
-					// do not explore within recursive object
-					return indx
+			for _, run := range group {
+				file, err := os.Open(run.Name)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "\nERROR: Unable to open sort run file\n")
+					os.Exit(1)
+				}
+				run.File = file
+				run.Reader = bufio.NewReader(file)
+				if run.next() {
+					heap.Push(hp, run)
 				}
 			}
-		}
 
-		// clearing prnt "*" now allows nested exploration within recursive data, e.g., -pattern Taxon -block */Taxon
-		if prnt == "*" {
-			prnt = ""
-		}
+			for hp.Len() > 0 {
+				run := (*hp)[0]
+				proc(run.Curr)
+				if run.next() {
+					heap.Fix(hp, 0)
+				} else {
+					heap.Pop(hp)
+				}
+			}
 
-		// explore child nodes
-		for chld := curr.Children; chld != nil; chld = chld.Next {
-			indx = exploreNodes(chld, indx, levl+1, proc)
+			for _, run := range group {
+				run.File.Close()
+				run.File = nil
+				run.Reader = nil
+			}
 		}
 
-		return indx
-	}
+		for ext := range inp {
 
-	// apply -position test
+			if ext.Text == "" {
+				continue
+			}
 
-	if cmds.Position == "" {
+			recs = append(recs, ext)
+			size += len(ext.Text) + len(ext.Ident)
 
-		exploreNodes(curr, index, level, processNode)
+			if size >= limit {
+				sort.Slice(recs, func(i, j int) bool { return sortedBefore(recs[i], recs[j]) })
+				writeRun()
+			}
+		}
 
-	} else {
+		sort.Slice(recs, func(i, j int) bool { return sortedBefore(recs[i], recs[j]) })
 
-		var single *Node
-		lev := 0
-		ind := 0
+		// everything fit in memory
+		if len(runs) == 0 {
+			for _, ext := range recs {
+				out <- ext
+			}
+			return
+		}
 
-		if cmds.Position == "first" {
+		if len(recs) > 0 {
+			writeRun()
+		}
 
-			exploreNodes(curr, index, level,
-				func(node *Node, idx, lvl int) {
-					if single == nil {
-						single = node
-						ind = idx
-						lev = lvl
-					}
-				})
+		// intermediate passes combine the oldest runs until few enough remain for the final merge
+		for len(runs) > maxMergeRuns {
+			group := runs[:maxMergeRuns]
+			run, file, wrtr := newRun()
+			mergeRuns(group, func(ext Extract) {
+				writeRecord(wrtr, ext)
+			})
+			closeRun(file, wrtr)
+			for _, old := range group {
+				os.Remove(old.Name)
+			}
+			runs = append(runs[maxMergeRuns:], run)
+		}
 
-		} else if cmds.Position == "last" {
+		mergeRuns(runs, func(ext Extract) {
+			out <- ext
+		})
+	}
 
-			exploreNodes(curr, index, level,
-				func(node *Node, idx, lvl int) {
-					single = node
-					ind = idx
-					lev = lvl
-				})
+	// launch single sorter goroutine
+	go xmlSorter(inp, out)
 
-		} else {
+	return out
+}
 
-			// use numeric position
-			number, err := strconv.Atoi(cmds.Position)
-			if err == nil {
+// RECORD UNIQUENESS FILTER
 
-				pos := 0
+// KeyRun is a sorted temporary file of length-prefixed keys, with the first key and offset of each block kept in memory
+type KeyRun struct {
+	File   *os.File
+	Count  int64
+	Firsts []string
+	Starts []int64
+}
 
-				exploreNodes(curr, index, level,
-					func(node *Node, idx, lvl int) {
-						pos++
-						if pos == number {
-							single = node
-							ind = idx
-							lev = lvl
-						}
-					})
+// KeySet records full keys in memory, spilling them to sorted runs that are merged when of similar size
+type KeySet struct {
+	Memory map[string]bool
+	Size   int
+	Limit  int
+	Runs   []*KeyRun
+}
 
-			} else {
+// NewKeySet returns an empty set that keeps up to limit bytes of keys in memory
+func NewKeySet(limit int) *KeySet {
 
-				fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized position '%s'\n", cmds.Position)
-				os.Exit(1)
-			}
-		}
+	if limit < 1 {
+		limit = 1 << 27
+	}
 
-		if single != nil {
-			processNode(single, ind, lev)
-		}
+	return &KeySet{Memory: make(map[string]bool), Limit: limit}
+}
+
+// writeKeyRun saves keys from an ascending iterator, starting a new block about every 16 KB
+func writeKeyRun(next func() (string, bool)) *KeyRun {
+
+	file, err := ioutil.TempFile("", "xtract-keys-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create key spill file\n")
+		os.Exit(1)
 	}
 
-	return tab, ret
-}
+	run := &KeyRun{File: file}
 
-// PROCESS ONE XML COMPONENT RECORD
+	wrtr := bufio.NewWriter(file)
+	buf := make([]byte, binary.MaxVarintLen64)
+	pos := int64(0)
+	block := int64(-1)
 
-// ProcessQuery calls XML combined tokenizer parser on a partitioned string
-func ProcessQuery(Text, parent string, index int, cmds *Block, tbls *Tables, action SpecialType) string {
+	for {
+		key, ok := next()
+		if !ok {
+			break
+		}
+		if block < 0 || pos-block >= 16384 {
+			block = pos
+			run.Firsts = append(run.Firsts, key)
+			run.Starts = append(run.Starts, pos)
+		}
+		n := binary.PutUvarint(buf, uint64(len(key)))
+		wrtr.Write(buf[:n])
+		wrtr.WriteString(key)
+		pos += int64(n + len(key))
+		run.Count++
+	}
 
-	if Text == "" || tbls == nil {
-		return ""
+	if err := wrtr.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to write key spill file\n")
+		os.Exit(1)
 	}
 
-	// node farm variables
-	FarmPos := 0
-	FarmMax := tbls.FarmSize
-	FarmItems := make([]Node, FarmMax)
+	// final offset marks end of last block
+	run.Starts = append(run.Starts, pos)
 
-	// allocate multiple nodes in a large array for memory management efficiency
-	nextNode := func(strt, attr, prnt string) *Node {
+	return run
+}
 
-		// if farm array slots used up, allocate new array
-		if FarmPos >= FarmMax {
-			FarmItems = make([]Node, FarmMax)
-			FarmPos = 0
-		}
+// readKeyRun returns an iterator over the keys of a run in ascending order
+func readKeyRun(run *KeyRun) func() (string, bool) {
 
-		if FarmItems == nil {
-			return nil
+	rdr := bufio.NewReader(io.NewSectionReader(run.File, 0, run.Starts[len(run.Starts)-1]))
+
+	return func() (string, bool) {
+		size, err := binary.ReadUvarint(rdr)
+		if err != nil {
+			return "", false
+		}
+		key := make([]byte, size)
+		if _, err := io.ReadFull(rdr, key); err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to read key spill file\n")
+			os.Exit(1)
 		}
+		return string(key), true
+	}
+}
 
-		// take node from next available slot in farm array
-		node := &FarmItems[FarmPos]
+// Contains reads the one block that could hold the key
+func (run *KeyRun) Contains(key string) bool {
 
-		node.Name = strt[:]
-		node.Attributes = attr[:]
-		node.Parent = prnt[:]
+	// index of last block starting at or before key
+	i := sort.SearchStrings(run.Firsts, key)
+	if i < len(run.Firsts) && run.Firsts[i] == key {
+		return true
+	}
+	i--
+	if i < 0 {
+		return false
+	}
 
-		FarmPos++
+	buf := make([]byte, run.Starts[i+1]-run.Starts[i])
+	if _, err := run.File.ReadAt(buf, run.Starts[i]); err != nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to read key spill file\n")
+		os.Exit(1)
+	}
 
-		return node
+	for len(buf) > 0 {
+		size, n := binary.Uvarint(buf)
+		if n <= 0 || int(size) > len(buf)-n {
+			break
+		}
+		str := string(buf[n : n+int(size)])
+		if str == key {
+			return true
+		}
+		if str > key {
+			break
+		}
+		buf = buf[n+int(size):]
 	}
 
-	// token parser variables
-	Txtlen := len(Text)
-	Idx := 0
+	return false
+}
 
-	plainText := (!tbls.DoStrict && !tbls.DoMixed)
+// Remove closes and deletes the run file
+func (run *KeyRun) Remove() {
 
-	// get next XML token
-	nextToken := func(idx int) (TagType, string, string, int) {
+	name := run.File.Name()
+	run.File.Close()
+	os.Remove(name)
+}
 
-		// lookup table array pointers
-		inBlank := &tbls.InBlank
-		inFirst := &tbls.InFirst
-		inElement := &tbls.InElement
+// spill writes in-memory keys as a new run, then merges runs of similar size so there are few to search
+func (set *KeySet) spill() {
 
-		text := Text[:]
-		txtlen := Txtlen
+	keys := make([]string, 0, len(set.Memory))
+	for key := range set.Memory {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-		// XML string ends with > character, acts as sentinel to check if past end of text
-		if idx >= txtlen {
-			// signal end of XML string
-			return ISCLOSED, "", "", 0
+	i := 0
+	set.Runs = append(set.Runs, writeKeyRun(func() (string, bool) {
+		if i >= len(keys) {
+			return "", false
 		}
+		i++
+		return keys[i-1], true
+	}))
 
-		// skip past leading blanks
-		ch := text[idx]
-		for inBlank[ch] {
-			idx++
-			ch = text[idx]
-		}
+	set.Memory = make(map[string]bool)
+	set.Size = 0
 
-		start := idx
+	// each key is rewritten about log2 of the number of spills times
+	for len(set.Runs) > 1 {
+		num := len(set.Runs)
+		older, newer := set.Runs[num-2], set.Runs[num-1]
+		if newer.Count < older.Count {
+			break
+		}
 
-		if ch == '<' && (plainText || HTMLAhead(text, idx) == 0) {
+		nextA, nextB := readKeyRun(older), readKeyRun(newer)
+		a, okA := nextA()
+		b, okB := nextB()
+		merged := writeKeyRun(func() (string, bool) {
+			if okA && (!okB || a <= b) {
+				key := a
+				a, okA = nextA()
+				return key, true
+			}
+			if okB {
+				key := b
+				b, okB = nextB()
+				return key, true
+			}
+			return "", false
+		})
 
-			// at start of element
-			idx++
-			ch = text[idx]
+		older.Remove()
+		newer.Remove()
+		set.Runs = append(set.Runs[:num-2], merged)
+	}
+}
 
-			// check for legal first character of element
-			if inFirst[ch] {
+// Add returns true if the key was not already present
+func (set *KeySet) Add(key string) bool {
 
-				// read element name
-				start = idx
-				idx++
+	if set.Memory[key] {
+		return false
+	}
+	for _, run := range set.Runs {
+		if run.Contains(key) {
+			return false
+		}
+	}
 
-				ch = text[idx]
-				for inElement[ch] {
-					idx++
-					ch = text[idx]
-				}
+	set.Memory[key] = true
+	// approximate map overhead per entry
+	set.Size += len(key) + 48
+	if set.Size >= set.Limit {
+		set.spill()
+	}
 
-				str := text[start:idx]
+	return true
+}
 
-				switch ch {
-				case '>':
-					// end of element
-					idx++
+// Close removes the spill files
+func (set *KeySet) Close() {
 
-					return STARTTAG, str[:], "", idx
-				case '/':
-					// self-closing element without attributes
-					idx++
-					ch = text[idx]
-					if ch != '>' {
-						fmt.Fprintf(os.Stderr, "\nSelf-closing element missing right angle bracket\n")
-					}
-					idx++
+	for _, run := range set.Runs {
+		run.Remove()
+	}
+	set.Runs = nil
+}
 
-					return SELFTAG, str[:], "", idx
-				case ' ', '\t', '\n', '\r', '\f':
-					// attributes
-					idx++
-					start = idx
-					ch = text[idx]
-					for ch != '<' && ch != '>' {
-						idx++
-						ch = text[idx]
-					}
-					if ch != '>' {
-						fmt.Fprintf(os.Stderr, "\nAttributes not followed by right angle bracket\n")
-					}
-					if text[idx-1] == '/' {
-						// self-closing
-						atr := text[start : idx-1]
-						idx++
-						return SELFTAG, str[:], atr[:], idx
-					}
-					atr := text[start:idx]
-					idx++
-					return STARTTAG, str[:], atr[:], idx
-				default:
-					fmt.Fprintf(os.Stderr, "\nUnexpected punctuation '%c' in XML element\n", ch)
-					return STARTTAG, str[:], "", idx
-				}
+// CreateUniqueFilter keeps the first or last record for each -unique-by key, blanking the others
+func CreateUniqueFilter(tbls *Tables, inp <-chan Extract, keepLast bool) <-chan Extract {
 
-			} else {
+	if tbls == nil || inp == nil {
+		return nil
+	}
 
-				// punctuation character immediately after first angle bracket
-				switch ch {
-				case '/':
-					// at start of end tag
-					idx++
-					start = idx
-					ch = text[idx]
-					// expect legal first character of element
-					if inFirst[ch] {
-						idx++
-						ch = text[idx]
-						for inElement[ch] {
-							idx++
-							ch = text[idx]
-						}
-						str := text[start:idx]
-						if ch != '>' {
-							fmt.Fprintf(os.Stderr, "\nUnexpected characters after end element name\n")
-						}
-						idx++
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create unique filter channel\n")
+		os.Exit(1)
+	}
 
-						return STOPTAG, str[:], "", idx
-					}
-					fmt.Fprintf(os.Stderr, "\nUnexpected punctuation '%c' in XML element\n", ch)
-				case '?':
-					// skip ?xml and ?processing instructions
-					idx++
-					ch = text[idx]
-					for ch != '>' {
-						idx++
-						ch = text[idx]
-					}
-					idx++
-				case '!':
-					// skip !DOCTYPE, !comment, and ![CDATA[
-					idx++
-					start = idx
-					ch = text[idx]
-					which := NOTAG
-					skipTo := ""
-					if ch == '[' && strings.HasPrefix(text[idx:], "[CDATA[") {
-						which = CDATATAG
-						skipTo = "]]>"
-						start += 7
-					} else if ch == '-' && strings.HasPrefix(text[idx:], "--") {
-						which = COMMENTTAG
-						skipTo = "-->"
-						start += 2
-					}
-					if which != NOTAG && skipTo != "" {
-						// CDATA or comment block may contain internal angle brackets
-						found := strings.Index(text[idx:], skipTo)
-						if found < 0 {
-							// string stops in middle of CDATA or comment
-							return ISCLOSED, "", "", idx
-						}
-						// adjust position past end of CDATA or comment
-						idx += found + len(skipTo)
-					} else {
-						// otherwise just skip to next right angle bracket
-						for ch != '>' {
-							idx++
-							ch = text[idx]
-						}
-						idx++
-					}
-				default:
-					fmt.Fprintf(os.Stderr, "\nUnexpected punctuation '%c' in XML element\n", ch)
-				}
-			}
+	// keepFirst passes records through as soon as their key is first seen
+	keepFirst := func(inp <-chan Extract, out chan<- Extract) {
 
-		} else if ch != '>' {
+		// close channel when all records have been processed
+		defer close(out)
 
-			// at start of contents
-			start = idx
+		set := NewKeySet(0)
+		defer set.Close()
 
-			// find end of contents
-			for {
-				for ch != '<' && ch != '>' {
-					idx++
-					ch = text[idx]
-				}
-				if ch == '<' && !plainText {
-					// optionally allow HTML text formatting elements and super/subscripts
-					advance := HTMLAhead(text, idx)
-					if advance > 0 {
-						idx += advance
-						ch = text[idx]
-						continue
-					}
-				}
-				break
-			}
+		for ext := range inp {
 
-			// trim back past trailing blanks
-			lst := idx - 1
-			ch = text[lst]
-			for inBlank[ch] && lst > start {
-				lst--
-				ch = text[lst]
+			// records without a key are always kept
+			if ext.Ident == "" || set.Add(ext.Ident) {
+				out <- ext
+				continue
 			}
 
-			str := text[start : lst+1]
-
-			return CONTENTTAG, str[:], "", idx
+			// send empty result to preserve record count
+			out <- Extract{ext.Index, ext.Ident, ""}
 		}
-
-		return NOTAG, "", "", idx
 	}
 
-	// Parse tokens into tree structure for exploration
+	// keepFinal spools results to disk, marks last occurrences in a backward pass, then sends in original order
+	keepFinal := func(inp <-chan Extract, out chan<- Extract) {
 
-	// parseLevel recursive definition
-	var parseLevel func(string, string, string) (*Node, bool)
+		// close channel when all records have been processed
+		defer close(out)
 
-	// parse XML tags into tree structure for searching
-	parseLevel = func(strt, attr, prnt string) (*Node, bool) {
+		spool, err := ioutil.TempFile("", "xtract-spool-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to create record spool file\n")
+			os.Exit(1)
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
 
-		ok := true
+		offsets, err := ioutil.TempFile("", "xtract-offsets-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to create record offset file\n")
+			os.Exit(1)
+		}
+		defer os.Remove(offsets.Name())
+		defer offsets.Close()
 
-		// obtain next node from farm
-		node := nextNode(strt, attr, prnt)
-		if node == nil {
-			return nil, false
+		// each spooled record is index, key length, and text length, followed by key and text
+		spwr := bufio.NewWriter(spool)
+		ofwr := bufio.NewWriter(offsets)
+		hdr := make([]byte, 16)
+		pos := int64(0)
+		count := int64(0)
+
+		for ext := range inp {
+			binary.BigEndian.PutUint64(hdr, uint64(pos))
+			ofwr.Write(hdr[:8])
+			binary.BigEndian.PutUint64(hdr, uint64(ext.Index))
+			binary.BigEndian.PutUint32(hdr[8:], uint32(len(ext.Ident)))
+			binary.BigEndian.PutUint32(hdr[12:], uint32(len(ext.Text)))
+			spwr.Write(hdr)
+			spwr.WriteString(ext.Ident)
+			spwr.WriteString(ext.Text)
+			pos += int64(16 + len(ext.Ident) + len(ext.Text))
+			count++
 		}
 
-		var lastNode *Node
+		if spwr.Flush() != nil || ofwr.Flush() != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to write record spool file\n")
+			os.Exit(1)
+		}
 
-		for {
-			tag, name, attr, idx := nextToken(Idx)
-			if tag == ISCLOSED {
-				break
+		readAt := func(file *os.File, buf []byte, ofs int64) {
+			if _, err := file.ReadAt(buf, ofs); err != nil {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unable to read record spool file\n")
+				os.Exit(1)
 			}
-			Idx = idx
+		}
 
-			switch tag {
-			case STARTTAG:
-				// read sub tree
-				obj, ok := parseLevel(name, attr, node.Name)
-				if !ok {
-					break
-				}
+		// one bit per record marks the last occurrence of each key
+		keep := make([]uint64, count/64+1)
 
-				// adding next child to end of linked list gives better performance than appending to slice of nodes
-				if node.Children == nil {
-					node.Children = obj
-				}
-				if lastNode != nil {
-					lastNode.Next = obj
-				}
-				lastNode = obj
-			case STOPTAG:
-				// pop out of recursive call
-				return node, ok
-			case CONTENTTAG:
-				if tbls.DoStrict {
-					if HasMarkup(name) {
-						name = RemoveUnicodeMarkup(name)
-					}
-					if HasAngleBracket(name) {
-						name = DoHTMLReplace(name)
-					}
-				}
-				if tbls.DoMixed {
-					if HasMarkup(name) {
-						name = SimulateUnicodeMarkup(name)
-					}
-					if HasAngleBracket(name) {
-						name = DoHTMLReplace(name)
-					}
-					name = DoTrimFlankingHTML(name)
-				}
-				if tbls.DeAccent {
-					if IsNotASCII(name) {
-						name = DoAccentTransform(name)
-					}
-				}
-				if tbls.DoASCII {
-					if IsNotASCII(name) {
-						name = UnicodeToASCII(name)
-					}
-				}
-				node.Contents = name
-			case SELFTAG:
-				if attr == "" {
-					// ignore if self-closing tag has no attributes
-					continue
-				}
+		set := NewKeySet(0)
+		defer set.Close()
 
-				// self-closing tag has no contents, just create child node
-				obj := nextNode(name, attr, node.Name)
+		for i := count - 1; i >= 0; i-- {
+			readAt(offsets, hdr[:8], i*8)
+			ofs := int64(binary.BigEndian.Uint64(hdr))
+			readAt(spool, hdr, ofs)
+			key := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+			if len(key) > 0 {
+				readAt(spool, key, ofs+16)
+			}
+			if len(key) == 0 || set.Add(string(key)) {
+				keep[i/64] |= 1 << uint(i%64)
+			}
+		}
 
-				if node.Children == nil {
-					node.Children = obj
-				}
-				if lastNode != nil {
-					lastNode.Next = obj
-				}
-				lastNode = obj
-				// continue on same level
-			default:
+		rdr := bufio.NewReader(spool)
+		if _, err := spool.Seek(0, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to rewind record spool file\n")
+			os.Exit(1)
+		}
+
+		for i := int64(0); i < count; i++ {
+			if _, err := io.ReadFull(rdr, hdr); err != nil {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unable to read record spool file\n")
+				os.Exit(1)
+			}
+			idx := int(binary.BigEndian.Uint64(hdr))
+			key := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+			txt := make([]byte, binary.BigEndian.Uint32(hdr[12:]))
+			io.ReadFull(rdr, key)
+			io.ReadFull(rdr, txt)
+
+			if keep[i/64]&(1<<uint(i%64)) != 0 {
+				out <- Extract{idx, string(key), string(txt)}
+				continue
 			}
+
+			// send empty result to preserve record count
+			out <- Extract{idx, string(key), ""}
 		}
+	}
 
-		return node, ok
+	// launch single filter goroutine
+	if keepLast {
+		go keepFinal(inp, out)
+	} else {
+		go keepFirst(inp, out)
 	}
 
-	// perform data extraction driven by command-line arguments
-	doQuery := func() string {
+	return out
+}
 
-		if cmds == nil {
-			return ""
-		}
+// ATTRIBUTE PIVOT TABLE
 
-		// exit from function will collect garbage of node structure for current XML object
-		tag, name, attr, idx := nextToken(Idx)
+// PivotArguments generates extraction commands for name and value pairs, with an optional fallback name attribute
+func PivotArguments(topPat, spec string) []string {
 
-		// loop until start tag
-		for {
-			if tag == ISCLOSED {
-				break
-			}
+	elem, attrs := SplitInTwoAt(spec, "@", LEFT)
+	names := strings.Split(attrs, "|")
+	if elem == "" || attrs == "" || len(names) > 2 {
+		fmt.Fprintf(os.Stderr, "\nERROR: -pivot '%s' must be Element@name or Element@name|fallback\n", spec)
+		os.Exit(1)
+	}
 
-			Idx = idx
+	// pairs are joined by a unit separator, and pairs are separated by a record separator
+	acc := []string{"-pattern", topPat, "-block", elem}
+	acc = append(acc, "-if", "@"+names[0], "-tab", "\x1E", "-sep", "\x1F", "-element", "@"+names[0]+","+elem)
+	if len(names) > 1 {
+		acc = append(acc, "-else", "-tab", "\x1E", "-sep", "\x1F", "-element", "@"+names[1]+","+elem)
+	}
 
-			if tag == STARTTAG {
-				break
-			}
+	return acc
+}
 
-			tag, name, attr, idx = nextToken(Idx)
-		}
+// CreatePivoter spools records while collecting attribute names, then prints a header and one row per record
+func CreatePivoter(tbls *Tables, inp <-chan Extract) <-chan Extract {
 
-		pat, ok := parseLevel(name, attr, parent)
+	if tbls == nil || inp == nil {
+		return nil
+	}
 
-		if !ok {
-			return ""
+	out := make(chan Extract, tbls.ChanDepth)
+	if out == nil {
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create pivot channel\n")
+		os.Exit(1)
+	}
+
+	// xmlPivoter makes two passes, the second over a temporary spool file
+	xmlPivoter := func(inp <-chan Extract, out chan<- Extract) {
+
+		// close channel when all records have been processed
+		defer close(out)
+
+		spool, err := ioutil.TempFile("", "xtract-pivot-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to create pivot spool file\n")
+			os.Exit(1)
 		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
 
-		// exit from function will also free map of recorded variables for current -pattern
-		variables := make(map[string]string)
+		// attribute names in order of first appearance
+		var names []string
+		column := make(map[string]int)
 
-		var buffer bytes.Buffer
+		// number of leading extraction columns
+		lead := 0
 
-		ok = false
+		wrtr := bufio.NewWriter(spool)
+		hdr := make([]byte, 12)
+		count := 0
 
-		if tbls.Hd != "" {
-			buffer.WriteString(tbls.Hd[:])
-		}
+		for ext := range inp {
 
-		// start processing at top of command tree and top of XML subregion selected by -pattern
-		_, ret := ProcessCommands(cmds, pat, "", "", index, 1, variables,
-			func(str string) {
-				if str != "" {
-					ok = true
-					buffer.WriteString(str)
+			txt, pairs := SplitInTwoAt(ext.Text, "\x1D", LEFT)
+			txt = strings.TrimSuffix(txt, "\n")
+
+			for _, pair := range strings.Split(strings.TrimSpace(pairs), "\x1E") {
+				name, _ := SplitInTwoAt(pair, "\x1F", LEFT)
+				if name == "" {
+					continue
 				}
-			})
+				if _, ok := column[name]; !ok {
+					column[name] = len(names)
+					names = append(names, name)
+				}
+			}
 
-		if tbls.Tl != "" {
-			buffer.WriteString(tbls.Tl[:])
+			if txt != "" {
+				if num := strings.Count(txt, "\t") + 1; num > lead {
+					lead = num
+				}
+			}
+
+			binary.BigEndian.PutUint64(hdr, uint64(ext.Index))
+			binary.BigEndian.PutUint32(hdr[8:], uint32(len(ext.Text)))
+			wrtr.Write(hdr)
+			wrtr.WriteString(ext.Text)
+			count++
 		}
 
-		if ret != "" {
-			ok = true
-			buffer.WriteString(ret)
+		if err := wrtr.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to write pivot spool file\n")
+			os.Exit(1)
 		}
 
-		txt := buffer.String()
+		if lead < 1 && len(names) < 1 {
+			// no record had output
+			return
+		}
 
-		// remove leading newline (-insd -pfx artifact)
-		if txt != "" && txt[0] == '\n' {
-			txt = txt[1:]
+		// header is the union of names, with blank headings over leading extraction columns
+		var buffer bytes.Buffer
+		if lead > 0 {
+			buffer.WriteString(strings.Repeat("\t", lead-1))
+		}
+		if len(names) > 0 {
+			if lead > 0 {
+				buffer.WriteString("\t")
+			}
+			buffer.WriteString(strings.Join(names, "\t"))
 		}
+		buffer.WriteString("\n")
+		out <- Extract{0, "", buffer.String()}
 
-		if !ok {
-			return ""
+		if _, err := spool.Seek(0, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to rewind pivot spool file\n")
+			os.Exit(1)
 		}
+		rdr := bufio.NewReader(spool)
 
-		// return consolidated result string
-		return txt
-	}
+		// tabs and line breaks inside values would shift columns
+		cleaner := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
 
-	// Stream tokens to obtain value of single index element
+		for i := 0; i < count; i++ {
 
-	// parseIndex recursive definition
-	var parseIndex func(string, string, string) string
+			if _, err := io.ReadFull(rdr, hdr); err != nil {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unable to read pivot spool file\n")
+				os.Exit(1)
+			}
+			idx := int(binary.BigEndian.Uint64(hdr))
+			data := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+			io.ReadFull(rdr, data)
 
-	// parse XML tags looking for trie index element
-	parseIndex = func(strt, attr, prnt string) string {
+			txt, pairs := SplitInTwoAt(string(data), "\x1D", LEFT)
+			txt = strings.TrimSuffix(txt, "\n")
+			pairs = strings.TrimSpace(pairs)
 
-		// check for attribute index match
-		if attr != "" && tbls.Attrib != "" && strings.Contains(attr, tbls.Attrib) {
-			if strt == tbls.Match || tbls.Match == "" {
-				if tbls.Parent == "" || prnt == tbls.Parent {
-					attribs := ParseAttributes(attr)
-					for i := 0; i < len(attribs)-1; i += 2 {
-						if attribs[i] == tbls.Attrib {
-							return attribs[i+1]
-						}
-					}
-				}
+			if txt == "" && pairs == "" {
+				// send empty result to preserve record count
+				out <- Extract{idx, "", ""}
+				continue
 			}
-		}
 
-		for {
-			tag, name, attr, idx := nextToken(Idx)
-			if tag == ISCLOSED {
-				break
+			// repeated names have values joined by vertical bars
+			vals := make([]string, len(names))
+			for _, pair := range strings.Split(pairs, "\x1E") {
+				name, val := SplitInTwoAt(pair, "\x1F", LEFT)
+				col, ok := column[name]
+				if !ok {
+					continue
+				}
+				val = cleaner.Replace(val)
+				if vals[col] != "" {
+					vals[col] += "|"
+				}
+				vals[col] += val
 			}
-			Idx = idx
 
-			switch tag {
-			case STARTTAG:
-				id := parseIndex(name, attr, strt)
-				if id != "" {
-					return id
-				}
-			case SELFTAG:
-			case STOPTAG:
-				// break recursion
-				return ""
-			case CONTENTTAG:
-				// check for content index match
-				if strt == tbls.Match || tbls.Match == "" {
-					if tbls.Parent == "" || prnt == tbls.Parent {
-						return name
-					}
+			buffer.Reset()
+			buffer.WriteString(txt)
+			if lead > 0 {
+				buffer.WriteString(strings.Repeat("\t", lead-1-strings.Count(txt, "\t")))
+			}
+			if len(names) > 0 {
+				if lead > 0 {
+					buffer.WriteString("\t")
 				}
-			default:
+				buffer.WriteString(strings.Join(vals, "\t"))
 			}
-		}
+			buffer.WriteString("\n")
 
-		return ""
+			out <- Extract{idx, "", buffer.String()}
+		}
 	}
 
-	// just return indexed identifier
-	doIndex := func() string {
+	// launch single pivot goroutine
+	go xmlPivoter(inp, out)
 
-		if tbls.Index == "" {
-			return ""
-		}
+	return out
+}
 
-		tag, name, attr, idx := nextToken(Idx)
+// HISTOGRAMS AND CHARTS
 
-		// loop until start tag
-		for {
-			if tag == ISCLOSED {
-				break
-			}
+// HistogramBins describes fixed-width, logarithmic, or calendar month binning
+type HistogramBins struct {
+	Kind   string
+	Width  float64
+	Places int
+	Base   float64
+}
 
-			Idx = idx
+// maxFilledBins limits the empty bins inserted between occupied ones, so a stray value cannot exhaust memory
+const maxFilledBins = 1000
 
-			if tag == STARTTAG {
-				break
-			}
+// monthIs maps abbreviated month names in PubDate and MedlineDate values to month numbers
+var monthIs = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
 
-			tag, name, attr, idx = nextToken(Idx)
-		}
+// dateRegex matches a leading year with an optional numeric or abbreviated month
+var dateRegex = regexp.MustCompile(`^(\d{4})(?:[-/ ](\d{1,2}|[A-Za-z]{3}))?`)
 
-		return parseIndex(name, attr, parent)
+// ParseHistogramBins recognizes a bin width, log, log2, log10, year, or month
+func ParseHistogramBins(str string) HistogramBins {
+
+	switch strings.ToLower(str) {
+	case "", "year":
+		return HistogramBins{Kind: "width", Width: 1}
+	case "log", "log10":
+		return HistogramBins{Kind: "log", Base: 10}
+	case "log2":
+		return HistogramBins{Kind: "log", Base: 2}
+	case "month":
+		return HistogramBins{Kind: "month"}
 	}
 
-	// ProcessQuery
+	_, width, _, ok := ParseNumber(str)
+	if !ok || width <= 0 {
+		fmt.Fprintf(os.Stderr, "\nERROR: Histogram bins '%s' must be a positive width, log, log2, year, or month\n", str)
+		os.Exit(1)
+	}
 
-	// call specific function
-	switch action {
-	case DOQUERY:
-		return doQuery()
-	case DOINDEX:
-		return doIndex()
-	default:
+	// labels are printed with as many decimal places as the width, e.g., 0.1 or 2.5
+	places := 0
+	if strings.ContainsAny(str, "eE") {
+		// shortest representation for exponential notation
+		places = -1
+	} else if pos := strings.Index(str, "."); pos >= 0 {
+		places = len(str) - pos - 1
 	}
 
-	return ""
+	return HistogramBins{Kind: "width", Width: width, Places: places}
 }
 
-// CONVERT IDENTIFIER TO DIRECTORY PATH FOR LOCAL FILE ARCHIVE
-
-// MakeArchiveTrie allows a short prefix of letters with an optional underscore, and splits the remainder into character pairs
-func MakeArchiveTrie(str string, arry [132]rune) string {
+// ParseDateValue returns the year and month of a date, with month 0 if absent
+func ParseDateValue(str string) (int, int, bool) {
 
-	if len(str) > 64 {
-		return ""
+	res := dateRegex.FindStringSubmatch(strings.TrimSpace(str))
+	if res == nil {
+		return 0, 0, false
 	}
 
-	max := 4
-	k := 0
-	for _, ch := range str {
-		if unicode.IsLetter(ch) {
-			k++
-			continue
-		}
-		if ch == '_' {
-			k++
-			max = 6
+	year, _ := strconv.Atoi(res[1])
+	month := 0
+	if res[2] != "" {
+		if num, err := strconv.Atoi(res[2]); err == nil && num >= 1 && num <= 12 {
+			month = num
+		} else {
+			month = monthIs[strings.ToUpper(res[2])]
 		}
-		break
 	}
 
-	// prefix is up to three letters if followed by digits, or up to four letters if followed by an underscore
-	pfx := str[:k]
-	if len(pfx) < max {
-		str = str[k:]
-	} else {
-		pfx = ""
-	}
+	return year, month, true
+}
 
-	i := 0
+// BinIndex assigns a value to a bin, using the year of dates that are not plain numbers
+func (bins HistogramBins) BinIndex(str string) (int, bool) {
 
-	if pfx != "" {
-		for _, ch := range pfx {
-			arry[i] = ch
-			i++
+	str = strings.TrimSpace(str)
+
+	if bins.Kind == "month" {
+		year, month, ok := ParseDateValue(str)
+		if !ok || month == 0 {
+			return 0, false
 		}
-		arry[i] = '/'
-		i++
+		return year*12 + month - 1, true
 	}
 
-	between := 0
-	doSlash := false
-
-	// remainder is divided in character pairs, e.g., NP_/06/00/51 for NP_060051.2
-	for _, ch := range str {
-		// break at period separating accession from version
-		if ch == '.' {
-			break
-		}
-		if doSlash {
-			arry[i] = '/'
-			i++
-			doSlash = false
-		}
-		arry[i] = ch
-		i++
-		between++
-		if between > 1 {
-			doSlash = true
-			between = 0
+	_, flt, _, ok := ParseNumber(str)
+	if !ok {
+		year, _, isDate := ParseDateValue(str)
+		if !isDate {
+			return 0, false
 		}
+		flt = float64(year)
 	}
 
-	return strings.ToUpper(string(arry[:i]))
-}
+	if bins.Kind == "log" {
+		if flt <= 0 {
+			return 0, false
+		}
+		// small offset keeps exact powers in their own bin despite rounding
+		return int(math.Floor(math.Log(flt)/math.Log(bins.Base) + 1e-9)), true
+	}
 
-// CONVERT TERM TO DIRECTORY PATH FOR POSTINGS FILE STORAGE
+	quo := flt / bins.Width
+	if math.IsNaN(quo) || math.Abs(quo) > 1e12 {
+		// too many bins to count reliably
+		return 0, false
+	}
 
-// MakePostingsTrie splits a string into characters, separated by path delimiting slashes
-func MakePostingsTrie(str string, arry [516]rune) string {
+	// offset well above rounding error keeps bin boundaries of fractional widths, e.g., 0.3 with width 0.1
+	return int(math.Floor(quo + math.Max(1e-9, math.Abs(quo)*1e-13))), true
+}
 
-	if len(str) > 256 {
-		return ""
-	}
+// BinLabel prints the lower bound of a bin, or YYYY-MM for months
+func (bins HistogramBins) BinLabel(idx int) string {
 
-	i := 0
-	doSlash := false
-	for _, ch := range str {
-		if doSlash {
-			arry[i] = '/'
-			i++
-		}
-		if ch == ' ' {
-			ch = '_'
+	switch bins.Kind {
+	case "month":
+		year := idx / 12
+		if idx < 0 && idx%12 != 0 {
+			year--
 		}
-		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) {
-			ch = '_'
-		}
-		arry[i] = ch
-		i++
-		doSlash = true
+		month := idx - year*12 + 1
+		return fmt.Sprintf("%04d-%02d", year, month)
+	case "log":
+		return FormatFloat(math.Pow(bins.Base, float64(idx)))
 	}
 
-	return strings.ToLower(string(arry[:i]))
+	return strconv.FormatFloat(float64(idx)*bins.Width, 'f', bins.Places, 64)
 }
 
-// UNSHUFFLER USES HEAP TO RESTORE OUTPUT OF MULTIPLE CONSUMERS TO ORIGINAL RECORD ORDER
-
-type Extract struct {
-	Index int
-	Ident string
-	Text  string
+// chartColors are used in turn for each group
+var chartColors = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf",
 }
 
-type ExtractHeap []Extract
+// RenderChart draws a bar or line chart of counts per bin, with one series per group, as SVG
+func RenderChart(kind string, labels, groups []string, counts [][]int) string {
 
-// methods that satisfy heap.Interface
-func (h ExtractHeap) Len() int {
-	return len(h)
-}
-func (h ExtractHeap) Less(i, j int) bool {
-	return h[i].Index < h[j].Index
-}
-func (h ExtractHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-}
-func (h *ExtractHeap) Push(x interface{}) {
-	*h = append(*h, x.(Extract))
-}
-func (h *ExtractHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
-}
+	const (
+		width  = 720
+		height = 420
+		left   = 60
+		right  = 20
+		top    = 20
+		bottom = 60
+	)
 
-// CONCURRENT CONSUMER GOROUTINES PARSE AND PROCESS PARTITIONED XML OBJECTS
+	plotW := float64(width - left - right)
+	plotH := float64(height - top - bottom)
 
-// ReadBlocks -> SplitPattern => StreamTokens => ParseXML => ProcessQuery -> MergeResults
+	max := 0
+	for _, row := range counts {
+		for _, num := range row {
+			if num > max {
+				max = num
+			}
+		}
+	}
 
-// process with single goroutine calls defer close(out) so consumer(s) can range over channel
-// process with multiple instances calls defer wg.Done(), separate goroutine uses wg.Wait() to delay close(out)
+	// round axis maximum up to a multiple of 1, 2, or 5 times a power of ten
+	step := 1
+	for _, mult := range []int{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000, 200000, 500000, 1000000} {
+		step = mult
+		if max <= mult*5 {
+			break
+		}
+	}
+	for step*5 < max {
+		step *= 10
+	}
+	axisMax := step * 5
+	if axisMax < 1 {
+		axisMax = 1
+	}
 
-func CreateProducer(pat, star string, rdr *XMLReader, tbls *Tables) <-chan Extract {
+	nbins := len(labels)
+	slot := plotW
+	if nbins > 0 {
+		slot = plotW / float64(nbins)
+	}
 
-	if rdr == nil || tbls == nil {
-		return nil
+	xPos := func(i int) float64 {
+		return float64(left) + slot*(float64(i)+0.5)
+	}
+	yPos := func(num int) float64 {
+		return float64(top) + plotH*(1-float64(num)/float64(axisMax))
 	}
 
-	out := make(chan Extract, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create producer channel\n")
-		os.Exit(1)
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(&buffer, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"11\">\n", width, height, width, height)
+	fmt.Fprintf(&buffer, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height)
+
+	// horizontal grid lines and count labels
+	for i := 0; i <= 5; i++ {
+		num := step * i
+		y := yPos(num)
+		fmt.Fprintf(&buffer, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\" stroke=\"#dddddd\"/>\n", left, y, width-right, y)
+		fmt.Fprintf(&buffer, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%d</text>\n", left-6, y+4, num)
 	}
 
-	// xmlProducer sends partitioned XML strings through channel
-	xmlProducer := func(pat, star string, rdr *XMLReader, out chan<- Extract) {
+	// label at most about twenty bins to keep text from overlapping
+	every := (nbins + 19) / 20
+	if every < 1 {
+		every = 1
+	}
+	for i, lbl := range labels {
+		if i%every != 0 {
+			continue
+		}
+		x := xPos(i)
+		fmt.Fprintf(&buffer, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"end\" transform=\"rotate(-45 %.1f %d)\">%s</text>\n", x, height-bottom+16, x, height-bottom+16, html.EscapeString(lbl))
+	}
 
-		// close channel when all records have been processed
-		defer close(out)
+	ngroups := len(counts)
+	for g, row := range counts {
+		color := chartColors[g%len(chartColors)]
+		if kind == "line" {
+			var points []string
+			for i, num := range row {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", xPos(i), yPos(num)))
+			}
+			fmt.Fprintf(&buffer, "<polyline fill=\"none\" stroke=\"%s\" stroke-width=\"2\" points=\"%s\"/>\n", color, strings.Join(points, " "))
+			continue
+		}
+		// bars of different groups are placed side by side within each bin
+		barW := slot * 0.8 / float64(ngroups)
+		for i, num := range row {
+			x := float64(left) + slot*float64(i) + slot*0.1 + barW*float64(g)
+			y := yPos(num)
+			fmt.Fprintf(&buffer, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"/>\n", x, y, barW, float64(top)+plotH-y, color)
+		}
+	}
 
-		// partition all input by pattern and send XML substring to available consumer through channel
-		PartitionPattern(pat, star, rdr,
-			func(rec int, ofs int64, str string) {
-				out <- Extract{rec, "", str}
-			})
+	// axes
+	fmt.Fprintf(&buffer, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>\n", left, top, left, height-bottom)
+	fmt.Fprintf(&buffer, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>\n", left, height-bottom, width-right, height-bottom)
+
+	// legend only when there are named groups
+	for g, name := range groups {
+		if name == "" {
+			continue
+		}
+		y := top + 4 + g*16
+		fmt.Fprintf(&buffer, "<rect x=\"%d\" y=\"%d\" width=\"10\" height=\"10\" fill=\"%s\"/>\n", width-right-140, y, chartColors[g%len(chartColors)])
+		fmt.Fprintf(&buffer, "<text x=\"%d\" y=\"%d\">%s</text>\n", width-right-125, y+9, html.EscapeString(name))
 	}
 
-	// launch single producer goroutine
-	go xmlProducer(pat, star, rdr, out)
+	buffer.WriteString("</svg>\n")
 
-	return out
+	return buffer.String()
 }
 
-func CreateUIDReader(in io.Reader, tbls *Tables) <-chan Extract {
+// CreateHistogram counts binned column values for each group, then prints a table or SVG chart
+func CreateHistogram(tbls *Tables, inp <-chan Extract, col int, bins HistogramBins, byCol int, chart string) <-chan Extract {
 
-	if in == nil || tbls == nil {
+	if tbls == nil || inp == nil {
 		return nil
 	}
 
 	out := make(chan Extract, tbls.ChanDepth)
 	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create uid reader channel\n")
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create histogram channel\n")
 		os.Exit(1)
 	}
 
-	// uidReader reads uids from input stream and sends through channel
-	uidReader := func(in io.Reader, out chan<- Extract) {
+	// xmlHistogram tallies each output row
+	xmlHistogram := func(inp <-chan Extract, out chan<- Extract) {
 
 		// close channel when all records have been processed
 		defer close(out)
 
-		scanr := bufio.NewScanner(in)
+		var groups []string
+		tallies := make(map[string]map[int]int)
+		first := true
+		lo, hi := 0, 0
+		last := 0
 
-		idx := 0
-		for scanr.Scan() {
+		for ext := range inp {
 
-			// read lines of identifiers
-			file := scanr.Text()
-			idx++
+			last = ext.Index
 
-			out <- Extract{idx, "", file}
+			for _, line := range strings.Split(ext.Text, "\n") {
+				if line == "" {
+					continue
+				}
+				cols := strings.Split(line, "\t")
+				if col > len(cols) {
+					continue
+				}
+				idx, ok := bins.BinIndex(cols[col-1])
+				if !ok {
+					continue
+				}
+
+				grp := ""
+				if byCol > 0 && byCol <= len(cols) {
+					grp = cols[byCol-1]
+				}
+				tally, ok := tallies[grp]
+				if !ok {
+					tally = make(map[int]int)
+					tallies[grp] = tally
+					groups = append(groups, grp)
+				}
+				tally[idx]++
+
+				if first || idx < lo {
+					lo = idx
+				}
+				if first || idx > hi {
+					hi = idx
+				}
+				first = false
+			}
+
+			// send empty result to preserve record count
+			out <- Extract{ext.Index, ext.Ident, ""}
 		}
-	}
 
-	// launch single uid reader goroutine
-	go uidReader(in, out)
+		if first {
+			return
+		}
+
+		// empty bins between the lowest and highest values are included, so series are continuous
+		var order []int
+		if hi-lo < maxFilledBins {
+			for idx := lo; idx <= hi; idx++ {
+				order = append(order, idx)
+			}
+		} else {
+			// sparse range shows only occupied bins
+			occupied := make(map[int]bool)
+			for _, tally := range tallies {
+				for idx := range tally {
+					occupied[idx] = true
+				}
+			}
+			for idx := range occupied {
+				order = append(order, idx)
+			}
+			sort.Ints(order)
+		}
+
+		var labels []string
+		for _, idx := range order {
+			labels = append(labels, bins.BinLabel(idx))
+		}
+
+		counts := make([][]int, len(groups))
+		for g, grp := range groups {
+			for _, idx := range order {
+				counts[g] = append(counts[g], tallies[grp][idx])
+			}
+		}
+
+		if chart != "" {
+			out <- Extract{last + 1, "", RenderChart(chart, labels, groups, counts)}
+			return
+		}
+
+		var buffer bytes.Buffer
+
+		for g, grp := range groups {
+			for i, lbl := range labels {
+				if byCol > 0 {
+					buffer.WriteString(grp)
+					buffer.WriteString("\t")
+				}
+				buffer.WriteString(lbl)
+				buffer.WriteString("\t")
+				buffer.WriteString(strconv.Itoa(counts[g][i]))
+				buffer.WriteString("\n")
+			}
+		}
+
+		out <- Extract{last + 1, "", buffer.String()}
+	}
+
+	// launch single histogram goroutine
+	go xmlHistogram(inp, out)
 
 	return out
 }
 
-func CreateConsumers(cmds *Block, tbls *Tables, parent string, inp <-chan Extract) <-chan Extract {
+// CODON USAGE TABULATION
 
-	if tbls == nil || inp == nil {
-		return nil
-	}
+// CodonCounts tallies unambiguous codons in the reading frame, in TTT, TTC, ... GGG table order
+func CodonCounts(seq string, frame int) []int {
 
-	out := make(chan Extract, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create consumer channel\n")
-		os.Exit(1)
-	}
+	counts := make([]int, 64)
 
-	// xmlConsumer reads partitioned XML from channel and calls parser for processing
-	xmlConsumer := func(cmds *Block, tbls *Tables, parent string, wg *sync.WaitGroup, inp <-chan Extract, out chan<- Extract) {
+	index := map[byte]int{'T': 0, 'U': 0, 'C': 1, 'A': 2, 'G': 3}
 
-		// report when this consumer has no more records to process
-		defer wg.Done()
+	seq = strings.ToUpper(seq)
 
-		// read partitioned XML from producer channel
-		for ext := range inp {
+	for i := frame - 1; i+3 <= len(seq); i += 3 {
+		first, ok1 := index[seq[i]]
+		second, ok2 := index[seq[i+1]]
+		third, ok3 := index[seq[i+2]]
+		if ok1 && ok2 && ok3 {
+			counts[first*16+second*4+third]++
+		}
+	}
 
-			idx := ext.Index
-			text := ext.Text
+	return counts
+}
 
-			if text == "" {
-				// should never see empty input data
-				out <- Extract{idx, "", text}
-				continue
-			}
+// FormatCodonCounts writes genetic code and counts as GCODE:N,N,...,N for the codon usage tabulator
+func FormatCodonCounts(gcode int, counts []int) string {
 
-			str := ProcessQuery(text[:], parent, idx, cmds, tbls, DOQUERY)
+	var buffer bytes.Buffer
 
-			// send even if empty to get all record counts for reordering
-			out <- Extract{idx, "", str}
+	buffer.WriteString(strconv.Itoa(gcode))
+	buffer.WriteString(":")
+	for i, num := range counts {
+		if i > 0 {
+			buffer.WriteString(",")
 		}
+		buffer.WriteString(strconv.Itoa(num))
 	}
 
-	var wg sync.WaitGroup
+	return buffer.String()
+}
 
-	// launch multiple consumer goroutines
-	for i := 0; i < tbls.NumServe; i++ {
-		wg.Add(1)
-		go xmlConsumer(cmds, tbls, parent, &wg, inp, out)
+// ParseCodonCounts recognizes a GCODE:N,N,...,N field, adding its counts to the accumulator
+func ParseCodonCounts(str string, counts []int) (int, bool) {
+
+	gc, vals := SplitInTwoAt(str, ":", LEFT)
+	gcode, err := strconv.Atoi(gc)
+	if err != nil {
+		return 0, false
+	}
+	if _, ok := geneticCodeIs[gcode]; !ok {
+		return 0, false
 	}
 
-	// launch separate anonymous goroutine to wait until all consumers are done
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
+	items := strings.Split(vals, ",")
+	if len(items) != 64 {
+		return 0, false
+	}
 
-	return out
-}
+	for i, item := range items {
+		num, err := strconv.Atoi(item)
+		if err != nil {
+			return 0, false
+		}
+		counts[i] += num
+	}
 
-func CreateExaminers(tbls *Tables, parent string, inp <-chan Extract) <-chan Extract {
+	return gcode, true
+}
 
-	if tbls == nil || inp == nil {
-		return nil
-	}
+// CodonUsageTable prints codon, amino acid, count, frequency per thousand, and relative synonymous codon usage
+func CodonUsageTable(id string, gcode int, counts []int) string {
 
-	out := make(chan Extract, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create examiner channel\n")
-		os.Exit(1)
+	code, ok := geneticCodeIs[gcode]
+	if !ok {
+		return ""
 	}
 
-	// xmlExaminer reads partitioned XML from channel and returns unique identifier
-	xmlExaminer := func(tbls *Tables, wg *sync.WaitGroup, inp <-chan Extract, out chan<- Extract) {
+	bases := "TCAG"
 
-		// report when this examiner has no more records to process
-		defer wg.Done()
+	total := 0
+	family := make(map[byte]int)
+	synonyms := make(map[byte]int)
+	for i, num := range counts {
+		aa := code.Residues[i]
+		total += num
+		family[aa] += num
+		synonyms[aa]++
+	}
 
-		// read partitioned XML from producer channel
-		for ext := range inp {
+	var buffer bytes.Buffer
 
-			idx := ext.Index
-			text := ext.Text
+	for i, num := range counts {
+		aa := code.Residues[i]
 
-			if text == "" {
-				// should never see empty input data
-				out <- Extract{idx, "", text}
-				continue
-			}
+		perThousand := 0.0
+		if total > 0 {
+			perThousand = float64(num) * 1000.0 / float64(total)
+		}
 
-			id := ProcessQuery(text[:], parent, 0, nil, tbls, DOINDEX)
+		// RSCU is observed count divided by count expected if all synonymous codons were used equally
+		rscu := 0.0
+		if family[aa] > 0 {
+			rscu = float64(num) * float64(synonyms[aa]) / float64(family[aa])
+		}
 
-			// send even if empty to get all record counts for reordering
-			out <- Extract{idx, id, text}
+		if id != "" {
+			buffer.WriteString(id)
+			buffer.WriteString("\t")
 		}
+		buffer.WriteByte(bases[i/16])
+		buffer.WriteByte(bases[(i/4)%4])
+		buffer.WriteByte(bases[i%4])
+		buffer.WriteString("\t")
+		buffer.WriteByte(aa)
+		buffer.WriteString("\t")
+		buffer.WriteString(strconv.Itoa(num))
+		buffer.WriteString("\t")
+		buffer.WriteString(strconv.FormatFloat(perThousand, 'f', 2, 64))
+		buffer.WriteString("\t")
+		buffer.WriteString(strconv.FormatFloat(rscu, 'f', 2, 64))
+		buffer.WriteString("\n")
 	}
 
-	var wg sync.WaitGroup
+	return buffer.String()
+}
 
-	// launch multiple examiner goroutines
-	for i := 0; i < tbls.NumServe; i++ {
-		wg.Add(1)
-		go xmlExaminer(tbls, &wg, inp, out)
-	}
+// ProcessCodonUsage generates extraction commands for codon counts of each non-pseudo CDS feature
+func ProcessCodonUsage(isPipe bool) []string {
 
-	// launch separate anonymous goroutine to wait until all examiners are done
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
+	var acc []string
 
-	return out
+	acc = append(acc, "-pattern", "INSDSeq")
+	// locus name is used if there is no accession
+	acc = append(acc, "-ACCN", "INSDSeq_locus", "-ACCN", "INSDSeq_accession-version")
+	if isPipe {
+		acc = append(acc, "-element", "&ACCN")
+	} else {
+		acc = append(acc, "-element", "\"&ACCN\"")
+	}
+	acc = append(acc, "-group", "INSDFeature", "-if", "INSDFeature_key", "-equals", "CDS")
+	acc = append(acc, "-unless", "INSDQualifier_name", "-equals", "pseudo")
+	acc = append(acc, "-codons", "INSDFeature")
+
+	return acc
 }
 
-func CreateUnshuffler(tbls *Tables, inp <-chan Extract) <-chan Extract {
+// CreateCodonTabulator converts -codons results into per-record tables, or one table for all records
+func CreateCodonTabulator(tbls *Tables, inp <-chan Extract, aggregate bool) <-chan Extract {
 
 	if tbls == nil || inp == nil {
 		return nil
@@ -8887,454 +15355,466 @@ func CreateUnshuffler(tbls *Tables, inp <-chan Extract) <-chan Extract {
 
 	out := make(chan Extract, tbls.ChanDepth)
 	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create unshuffler channel\n")
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create codon tabulator channel\n")
 		os.Exit(1)
 	}
 
-	// xmlUnshuffler restores original order with heap
-	xmlUnshuffler := func(inp <-chan Extract, out chan<- Extract) {
+	// xmlTabulator sums codon counts from each line of extraction output
+	xmlTabulator := func(inp <-chan Extract, out chan<- Extract) {
 
 		// close channel when all records have been processed
 		defer close(out)
 
-		// initialize empty heap
-		hp := &ExtractHeap{}
-		heap.Init(hp)
-
-		// index of next desired result
-		next := 1
-
-		delay := 0
+		totals := make([]int, 64)
+		gcode := 0
+		last := 0
 
 		for ext := range inp {
 
-			// push result onto heap
-			heap.Push(hp, ext)
-
-			// read several values before checking to see if next record to print has been processed
-			if delay < tbls.HeapSize {
-				delay++
-				continue
-			}
-
-			delay = 0
-
-			for hp.Len() > 0 {
-
-				// remove lowest item from heap, use interface type assertion
-				curr := heap.Pop(hp).(Extract)
+			last = ext.Index
 
-				if curr.Index > next {
+			counts := make([]int, 64)
+			id := ""
+			code := 0
 
-					// record should be printed later, push back onto heap
-					heap.Push(hp, curr)
-					// and go back to waiting on input channel
-					break
+			for _, line := range strings.Split(ext.Text, "\n") {
+				for _, fld := range strings.Split(line, "\t") {
+					if gc, ok := ParseCodonCounts(fld, counts); ok {
+						// first genetic code encountered determines amino acid assignments
+						if code == 0 {
+							code = gc
+						}
+					} else if id == "" && fld != "" {
+						id = fld
+					}
 				}
+			}
 
-				// send even if empty to get all record counts for reordering
-				out <- Extract{curr.Index, curr.Ident, curr.Text}
-
-				// prevent ambiguous -limit filter from clogging heap (deprecated)
-				if curr.Index == next {
-					// increment index for next expected match
-					next++
+			if aggregate {
+				for i, num := range counts {
+					totals[i] += num
+				}
+				if gcode == 0 {
+					gcode = code
 				}
+				// send empty result to preserve record count
+				out <- Extract{ext.Index, ext.Ident, ""}
+				continue
+			}
 
-				// keep checking heap to see if next result is already available
+			if code == 0 {
+				out <- Extract{ext.Index, ext.Ident, ""}
+				continue
 			}
-		}
 
-		// send remainder of heap to output
-		for hp.Len() > 0 {
-			curr := heap.Pop(hp).(Extract)
+			if id == "" {
+				id = strconv.Itoa(ext.Index)
+			}
 
-			out <- Extract{curr.Index, curr.Ident, curr.Text}
+			out <- Extract{ext.Index, ext.Ident, CodonUsageTable(id, code, counts)}
+		}
+
+		if aggregate && gcode != 0 {
+			out <- Extract{last + 1, "", CodonUsageTable("", gcode, totals)}
 		}
 	}
 
-	// launch single unshuffler goroutine
-	go xmlUnshuffler(inp, out)
+	// launch single tabulator goroutine
+	go xmlTabulator(inp, out)
 
 	return out
 }
 
-func CreateUniquer(tbls *Tables, inp <-chan Extract) <-chan Extract {
+// TAXONOMY TREE ASSEMBLY
 
-	if tbls == nil || inp == nil {
-		return nil
-	}
+// TaxonNode holds one taxon and the identifiers of its children in order of first appearance
+type TaxonNode struct {
+	TaxId    string
+	Parent   string
+	Rank     string
+	Name     string
+	Children []string
+}
 
-	out := make(chan Extract, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create uniquer channel\n")
-		os.Exit(1)
-	}
+// TaxonTree accumulates Taxon records and the ancestors listed in their LineageEx
+type TaxonTree struct {
+	Nodes   map[string]*TaxonNode
+	Records []string
+}
 
-	// xmlUniquer removes adjacent records with the same identifier
-	xmlUniquer := func(inp <-chan Extract, out chan<- Extract) {
+// lineageRanks are the fixed columns of -taxonomy lineage output
+var lineageRanks = []string{
+	"superkingdom",
+	"kingdom",
+	"phylum",
+	"class",
+	"order",
+	"family",
+	"genus",
+	"species",
+}
 
-		// close channel when all records have been processed
-		defer close(out)
+// rankColumnIs maps rank names, including newer synonyms, to lineage columns
+var rankColumnIs = map[string]int{
+	"superkingdom": 0,
+	"domain":       0,
+	"kingdom":      1,
+	"phylum":       2,
+	"class":        3,
+	"order":        4,
+	"family":       5,
+	"genus":        6,
+	"species":      7,
+}
 
-		// remember previous record
-		prev := Extract{}
+// NewTaxonTree returns an empty taxonomy tree
+func NewTaxonTree() *TaxonTree {
 
-		for curr := range inp {
+	return &TaxonTree{Nodes: make(map[string]*TaxonNode)}
+}
 
-			// compare adjacent record identifiers
-			if prev.Text != "" && prev.Ident != curr.Ident {
+// AddTaxon records a taxon, filling in fields left empty by earlier references
+func (tree *TaxonTree) AddTaxon(id, parent, rank, name string) *TaxonNode {
 
-				// if identifiers are different, send previous to output channel
-				out <- prev
-			}
+	if id == "" {
+		return nil
+	}
 
-			// now remember this record
-			prev = curr
-		}
+	node, ok := tree.Nodes[id]
+	if !ok {
+		node = &TaxonNode{TaxId: id}
+		tree.Nodes[id] = node
+	}
 
-		if prev.Text != "" {
+	if node.Rank == "" {
+		node.Rank = rank
+	}
+	if node.Name == "" {
+		node.Name = name
+	}
 
-			// send last record
-			out <- prev
+	if parent != "" && parent != id && node.Parent == "" {
+		node.Parent = parent
+		prnt, ok := tree.Nodes[parent]
+		if !ok {
+			prnt = &TaxonNode{TaxId: parent}
+			tree.Nodes[parent] = prnt
 		}
+		prnt.Children = append(prnt.Children, id)
 	}
 
-	// launch single uniquer goroutine
-	go xmlUniquer(inp, out)
-
-	return out
+	return node
 }
 
-func CreateDeleter(tbls *Tables, dltd string, inp <-chan Extract) <-chan Extract {
-
-	if tbls == nil || inp == nil {
-		return nil
-	}
+// AddRecord parses one -taxonomy extraction result, a TaxId, ParentTaxId, Rank, and ScientificName line
+// followed by one TaxId, Rank, and ScientificName line for each LineageEx ancestor from root to parent
+func (tree *TaxonTree) AddRecord(text string) string {
 
-	out := make(chan Extract, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create deleter channel\n")
-		os.Exit(1)
+	// extraction writes "-" for missing elements
+	clean := func(str string) string {
+		str = strings.TrimSpace(str)
+		if str == "-" {
+			return ""
+		}
+		return str
 	}
 
-	// map to track UIDs to skip
-	shouldSkip := make(map[string]bool)
-
-	checkMap := false
-
-	if dltd != "" && dltd != "-" {
-		fmt.Fprintf(os.Stderr, "\nEnter CreateDeleter Scanner\n")
-		checkMap = true
+	id := ""
+	parent := ""
+	prev := ""
 
-		skipFile, err := os.Open(dltd)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nERROR: Unable to read skip file\n")
-			os.Exit(1)
+	for i, line := range strings.Split(text, "\n") {
+		flds := strings.Split(strings.TrimRight(line, "\t"), "\t")
+		if i == 0 {
+			if len(flds) < 4 {
+				return ""
+			}
+			id = clean(flds[0])
+			parent = clean(flds[1])
+			tree.AddTaxon(id, parent, clean(flds[2]), clean(flds[3]))
+			continue
 		}
-
-		scanr := bufio.NewScanner(skipFile)
-
-		for scanr.Scan() {
-
-			// read lines of identifiers
-			id := scanr.Text()
-
-			// add to exclusion map
-			shouldSkip[id] = true
+		if len(flds) < 3 {
+			continue
 		}
-
-		skipFile.Close()
-		fmt.Fprintf(os.Stderr, "\nLeave CreateDeleter Scanner\n")
+		anc := clean(flds[0])
+		tree.AddTaxon(anc, prev, clean(flds[1]), clean(flds[2]))
+		prev = anc
 	}
 
-	// xmlDeleter removes records listed as deleted
-	xmlDeleter := func(inp <-chan Extract, out chan<- Extract) {
-
-		// close channel when all records have been processed
-		defer close(out)
+	// last LineageEx entry is the parent if ParentTaxId was absent
+	if id != "" && parent == "" && prev != "" {
+		tree.AddTaxon(id, prev, "", "")
+	}
 
-		for curr := range inp {
+	if id != "" {
+		tree.Records = append(tree.Records, id)
+	}
 
-			// check if identifier was deleted
-			if checkMap && shouldSkip[curr.Ident] {
-				continue
-			}
+	return id
+}
 
-			// send to output channel
-			out <- curr
+// Lineage returns the path from the root down to the requested taxon
+func (tree *TaxonTree) Lineage(id string) []*TaxonNode {
+
+	var path []*TaxonNode
+
+	// guard against cycles in malformed input
+	seen := make(map[string]bool)
+
+	for id != "" && !seen[id] {
+		node, ok := tree.Nodes[id]
+		if !ok {
+			break
 		}
+		seen[id] = true
+		path = append(path, node)
+		id = node.Parent
 	}
 
-	// launch single deleter goroutine
-	go xmlDeleter(inp, out)
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
 
-	return out
+	return path
 }
 
-func CreateStashers(tbls *Tables, inp <-chan Extract) <-chan string {
+// RankedLineage prints the taxon identifier and name followed by the name at each fixed rank
+func (tree *TaxonTree) RankedLineage(id string) string {
 
-	if tbls == nil || inp == nil {
-		return nil
+	node, ok := tree.Nodes[id]
+	if !ok {
+		return ""
 	}
 
-	out := make(chan string, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create stasher channel\n")
-		os.Exit(1)
+	cols := make([]string, len(lineageRanks))
+	for i := range cols {
+		cols[i] = "-"
 	}
 
-	sfx := ".xml"
-	if tbls.Zipp {
-		sfx = ".xml.gz"
+	for _, anc := range tree.Lineage(id) {
+		if col, ok := rankColumnIs[anc.Rank]; ok && anc.Name != "" {
+			cols[col] = anc.Name
+		}
 	}
 
-	type StasherType int
-
-	const (
-		OKAY StasherType = iota
-		WAIT
-		BAIL
-	)
+	name := node.Name
+	if name == "" {
+		name = "-"
+	}
 
-	// mutex to protect access to inUse map
-	var flock sync.Mutex
+	return id + "\t" + name + "\t" + strings.Join(cols, "\t")
+}
 
-	// map to track files currently being written
-	inUse := make(map[string]int)
+// CommonAncestor returns the lowest common ancestor of the known taxa in a set
+func (tree *TaxonTree) CommonAncestor(ids []string) *TaxonNode {
 
-	// lockFile function prevents colliding writes
-	lockFile := func(id string, index int) StasherType {
-		// map is non-reentrant, protect with mutex
-		flock.Lock()
-		// multiple return paths, schedule the unlock command up front
-		defer flock.Unlock()
+	var common []*TaxonNode
 
-		idx, ok := inUse[id]
+	found := false
 
-		if ok {
-			if idx < index {
-				// later version is being written by another goroutine, skip this
-				return BAIL
-			}
-			// earlier version is being written by another goroutine, wait
-			return WAIT
+	for _, id := range ids {
+		path := tree.Lineage(id)
+		if len(path) < 1 {
+			// unknown identifiers are ignored
+			continue
 		}
-
-		// okay to write file, mark in use to prevent collision
-		inUse[id] = index
-		return OKAY
+		if !found {
+			common = path
+			found = true
+			continue
+		}
+		j := 0
+		for j < len(common) && j < len(path) && common[j] == path[j] {
+			j++
+		}
+		common = common[:j]
 	}
 
-	// freeFile function removes entry from inUse map
-	freeFile := func(id string) {
-		flock.Lock()
-		// free entry in map, later versions of same record can now be written
-		delete(inUse, id)
-		flock.Unlock()
+	if len(common) < 1 {
+		return nil
 	}
 
-	// trimLeft function reformats output, efficiently skipping leading spaces on each line
-	trimLeft := func(text string) string {
+	return common[len(common)-1]
+}
 
-		if text == "" {
-			return ""
-		}
+// NewickLabel replaces blanks with underscores, quoting names that contain other Newick punctuation
+func NewickLabel(str string) string {
 
-		var buffer bytes.Buffer
+	if strings.ContainsAny(str, "()[]':;,_\t\n") {
+		return "'" + strings.Replace(str, "'", "''", -1) + "'"
+	}
 
-		max := len(text)
-		idx := 0
-		inBlank := &tbls.InBlank
+	return strings.Replace(str, " ", "_", -1)
+}
 
-		for idx < max {
+// Newick prints the accumulated tree in Newick format, joining separate roots under an unnamed node
+func (tree *TaxonTree) Newick() string {
 
-			// skip past leading blanks and empty lines
-			for idx < max {
-				ch := text[idx]
-				if !inBlank[ch] {
-					break
-				}
-				idx++
-			}
+	var buffer bytes.Buffer
 
-			start := idx
+	seen := make(map[string]bool)
 
-			// skip to next newline
-			for idx < max {
-				if text[idx] == '\n' {
-					break
-				}
-				idx++
-			}
+	var writeNode func(node *TaxonNode)
 
-			str := text[start:idx]
+	writeNode = func(node *TaxonNode) {
 
-			if str == "" {
-				continue
-			}
+		seen[node.TaxId] = true
 
-			// skip processing instruction
-			if strings.HasPrefix(str, "<?") && strings.HasSuffix(str, "?>") {
-				continue
+		if len(node.Children) > 0 {
+			buffer.WriteString("(")
+			between := ""
+			for _, child := range node.Children {
+				kid, ok := tree.Nodes[child]
+				if !ok || seen[child] {
+					continue
+				}
+				buffer.WriteString(between)
+				writeNode(kid)
+				between = ","
 			}
-
-			// trim spaces next to angle bracket
-			str = strings.Replace(str, "> ", ">", -1)
-			str = strings.Replace(str, " <", "<", -1)
-
-			buffer.WriteString(str[:])
-			buffer.WriteString("\n")
+			buffer.WriteString(")")
 		}
 
-		return buffer.String()
+		name := node.Name
+		if name == "" {
+			name = node.TaxId
+		}
+		buffer.WriteString(NewickLabel(name))
 	}
 
-	// stashRecord saves individual XML record to archive file accessed by trie
-	stashRecord := func(text, id string, index int) string {
-
-		var arry [132]rune
-		trie := MakeArchiveTrie(id, arry)
-		if trie == "" {
-			return ""
+	// roots are taxa without a parent, visited in order of first appearance in the data
+	var roots []*TaxonNode
+	isRoot := make(map[string]bool)
+	for _, id := range tree.Records {
+		path := tree.Lineage(id)
+		if len(path) < 1 {
+			continue
 		}
+		root := path[0]
+		if !isRoot[root.TaxId] {
+			isRoot[root.TaxId] = true
+			roots = append(roots, root)
+		}
+	}
 
-		attempts := 5
-		keepChecking := true
+	if len(roots) < 1 {
+		return ""
+	}
 
-		for keepChecking {
-			// check if file is not being written by another goroutine
-			switch lockFile(id, index) {
-			case OKAY:
-				// okay to save this record now
-				keepChecking = false
-			case WAIT:
-				// earlier version is being saved, wait one second and try again
-				time.Sleep(time.Second)
-				attempts--
-				if attempts < 1 {
-					// cannot get lock after several attempts
-					fmt.Fprintf(os.Stderr, "\nERROR: Unable to save '%s'\n", id)
-					return ""
-				}
-			case BAIL:
-				// later version is being saved, skip this one
-				return ""
-			default:
+	if len(roots) == 1 {
+		writeNode(roots[0])
+	} else {
+		buffer.WriteString("(")
+		for i, root := range roots {
+			if i > 0 {
+				buffer.WriteString(",")
 			}
+			writeNode(root)
 		}
+		buffer.WriteString(")")
+	}
 
-		// delete lock after writing file
-		defer freeFile(id)
-
-		dpath := path.Join(tbls.Stash, trie)
-		if dpath == "" {
-			return ""
-		}
-		_, err := os.Stat(dpath)
-		if err != nil && os.IsNotExist(err) {
-			err = os.MkdirAll(dpath, os.ModePerm)
-		}
-		if err != nil {
-			fmt.Println(err.Error())
-			return ""
-		}
-		fpath := path.Join(dpath, id+sfx)
-		if fpath == "" {
-			return ""
-		}
+	buffer.WriteString(";")
 
-		// overwrites and truncates existing file
-		fl, err := os.Create(fpath)
-		if err != nil {
-			fmt.Println(err.Error())
-			return ""
-		}
+	return buffer.String()
+}
 
-		// remove leading spaces on each line
-		str := trimLeft(text)
+// ReadTaxonSets collects comma- or space-separated taxid sets from arguments or from lines of named files
+func ReadTaxonSets(args []string) []string {
 
-		res := ""
+	var sets []string
 
-		if tbls.Hash {
-			// calculate hash code for verification table
-			hsh := crc32.NewIEEE()
-			hsh.Write([]byte(str))
-			val := hsh.Sum32()
-			res = strconv.FormatUint(uint64(val), 10)
+	for _, str := range args {
+		if _, err := os.Stat(str); err != nil {
+			sets = append(sets, str)
+			continue
 		}
 
-		if tbls.Zipp {
-
-			zpr, err := gzip.NewWriterLevel(fl, gzip.BestCompression)
-
-			if err == nil {
-				bfr := bufio.NewWriter(zpr)
+		data, err := ioutil.ReadFile(str)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to read taxonomy set file '%s'\n", str)
+			os.Exit(1)
+		}
 
-				// compress and copy record to file
-				bfr.WriteString(str)
-				if !strings.HasSuffix(str, "\n") {
-					bfr.WriteString("\n")
-				}
-				bfr.Flush()
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
 			}
+			sets = append(sets, line)
+		}
+	}
 
-			zpr.Close()
+	return sets
+}
 
-		} else {
+// TaxonCommonAncestors prints each set with the identifier, name, and rank of its lowest common ancestor
+func TaxonCommonAncestors(tree *TaxonTree, sets []string) string {
 
-			// copy record to file
-			fl.WriteString(str)
-			if !strings.HasSuffix(str, "\n") {
-				fl.WriteString("\n")
-			}
-		}
+	var buffer bytes.Buffer
 
-		err = fl.Sync()
-		if err != nil {
-			fmt.Println(err.Error())
+	// without sets, report the common ancestor of every record
+	if len(sets) < 1 {
+		if len(tree.Records) < 1 {
+			return ""
 		}
-		fl.Close()
-
-		return res
+		sets = append(sets, strings.Join(tree.Records, ","))
 	}
 
-	// xmlStasher reads from channel and calls stashRecord
-	xmlStasher := func(wg *sync.WaitGroup, inp <-chan Extract, out chan<- string) {
-
-		defer wg.Done()
+	for _, set := range sets {
+		ids := strings.FieldsFunc(set, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t'
+		})
 
-		for ext := range inp {
+		buffer.WriteString(strings.Join(ids, ","))
 
-			hsh := stashRecord(ext.Text, ext.Ident, ext.Index)
-			res := ext.Ident
-			if tbls.Hash {
-				res += "\t" + hsh
-			}
-			res += "\n"
+		node := tree.CommonAncestor(ids)
+		if node == nil {
+			buffer.WriteString("\t-\t-\t-\n")
+			continue
+		}
 
-			out <- res
+		name := node.Name
+		if name == "" {
+			name = "-"
 		}
+		rank := node.Rank
+		if rank == "" {
+			rank = "-"
+		}
+
+		buffer.WriteString("\t")
+		buffer.WriteString(node.TaxId)
+		buffer.WriteString("\t")
+		buffer.WriteString(name)
+		buffer.WriteString("\t")
+		buffer.WriteString(rank)
+		buffer.WriteString("\n")
 	}
 
-	var wg sync.WaitGroup
+	return buffer.String()
+}
 
-	// launch multiple stasher goroutines
-	for i := 0; i < tbls.NumServe; i++ {
-		wg.Add(1)
-		go xmlStasher(&wg, inp, out)
-	}
+// ProcessTaxonomy generates extraction commands for Taxon records and their LineageEx ancestors
+func ProcessTaxonomy(isPipe bool) []string {
 
-	// launch separate anonymous goroutine to wait until all stashers are done
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
+	var acc []string
 
-	return out
+	acc = append(acc, "-pattern", "Taxon", "-def", "-")
+	acc = append(acc, "-element", "TaxId", "ParentTaxId", "Rank", "ScientificName")
+	if isPipe {
+		acc = append(acc, "-block", "LineageEx/Taxon", "-tab", "", "-pfx", "\\n", "-sep", "\\t")
+	} else {
+		acc = append(acc, "-block", "LineageEx/Taxon", "-tab", "\"\"", "-pfx", "\"\\n\"", "-sep", "\"\\t\"")
+	}
+	acc = append(acc, "-element", "TaxId,Rank,ScientificName")
+
+	return acc
 }
 
-func CreateFetchers(tbls *Tables, inp <-chan Extract) <-chan Extract {
+// CreateTaxonomyBuilder assembles Taxon records into a tree, then prints lineages, common ancestors, or Newick
+func CreateTaxonomyBuilder(tbls *Tables, inp <-chan Extract, mode string, sets []string) <-chan Extract {
 
 	if tbls == nil || inp == nil {
 		return nil
@@ -9342,252 +15822,347 @@ func CreateFetchers(tbls *Tables, inp <-chan Extract) <-chan Extract {
 
 	out := make(chan Extract, tbls.ChanDepth)
 	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create fetcher channel\n")
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create taxonomy builder channel\n")
 		os.Exit(1)
 	}
 
-	sfx := ".xml"
-	if tbls.Zipp {
-		sfx = ".xml.gz"
-	}
-
-	// xmlFetcher reads XML from file
-	xmlFetcher := func(tbls *Tables, wg *sync.WaitGroup, inp <-chan Extract, out chan<- Extract) {
+	// xmlBuilder adds each record to the tree, printing lineages as records arrive
+	xmlBuilder := func(inp <-chan Extract, out chan<- Extract) {
 
-		// report when more records to process
-		defer wg.Done()
+		// close channel when all records have been processed
+		defer close(out)
 
-		var buf bytes.Buffer
+		tree := NewTaxonTree()
+		last := 0
 
 		for ext := range inp {
 
-			idx := ext.Index
-			file := ext.Text
+			last = ext.Index
 
-			var arry [132]rune
-			trie := MakeArchiveTrie(file, arry)
-			if trie == "" {
-				continue
-			}
+			id := tree.AddRecord(ext.Text)
 
-			fpath := path.Join(tbls.Stash, trie, file+sfx)
-			if fpath == "" {
+			if mode == "lineage" && id != "" {
+				// record carries its complete LineageEx, so ranks are already known
+				out <- Extract{ext.Index, ext.Ident, tree.RankedLineage(id) + "\n"}
 				continue
 			}
 
-			iszip := tbls.Zipp
-
-			inFile, err := os.Open(fpath)
+			// send empty result to preserve record count
+			out <- Extract{ext.Index, ext.Ident, ""}
+		}
 
-			// if failed to find ".xml" file, try ".xml.gz" without requiring -gzip
-			if err != nil && os.IsNotExist(err) && !tbls.Zipp {
-				iszip = true
-				fpath := path.Join(tbls.Stash, trie, file+".xml.gz")
-				if fpath == "" {
-					continue
-				}
-				inFile, err = os.Open(fpath)
-			}
-			if err != nil {
-				continue
-			}
+		txt := ""
+		switch mode {
+		case "lca":
+			txt = TaxonCommonAncestors(tree, sets)
+		case "newick":
+			txt = tree.Newick() + "\n"
+		}
 
-			buf.Reset()
+		if strings.TrimSpace(txt) != "" {
+			out <- Extract{last + 1, "", txt}
+		}
+	}
 
-			brd := bufio.NewReader(inFile)
+	// launch single builder goroutine
+	go xmlBuilder(inp, out)
 
-			if iszip {
+	return out
+}
 
-				zpr, err := gzip.NewReader(brd)
+// CROSS-RECORD AGGREGATION
 
-				if err == nil {
-					// copy and decompress cached file contents
-					buf.ReadFrom(zpr)
-				}
+// AggregateFunc is a summary function and the one-based column it reads
+type AggregateFunc struct {
+	Name   string
+	Column int
+}
 
-				zpr.Close()
+// aggregateFuncIs lists summary functions and whether each requires a column
+var aggregateFuncIs = map[string]bool{
+	"count":    false,
+	"sum":      true,
+	"min":      true,
+	"max":      true,
+	"mean":     true,
+	"stddev":   true,
+	"median":   true,
+	"distinct": true,
+}
 
-			} else {
+// AggregateState accumulates the values seen by one function within one group
+type AggregateState struct {
+	Count    int
+	Sum      float64
+	Min      float64
+	Max      float64
+	Mean     float64
+	M2       float64
+	Values   []float64
+	Distinct map[string]bool
+}
 
-				// copy cached file contents
-				buf.ReadFrom(brd)
-			}
+// AggregateGroup holds key column values, row count, and function states
+type AggregateGroup struct {
+	Key    []string
+	Rows   int
+	States []*AggregateState
+}
 
-			inFile.Close()
+// ParseColumnList converts comma-separated one-based column numbers
+func ParseColumnList(str, flag string) []int {
 
-			str := buf.String()
+	var cols []int
 
-			out <- Extract{idx, "", str}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
 		}
+		col, err := strconv.Atoi(item)
+		if err != nil || col < 1 {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized %s column '%s'\n", flag, item)
+			os.Exit(1)
+		}
+		cols = append(cols, col)
 	}
 
-	var wg sync.WaitGroup
-
-	// launch multiple fetcher goroutines
-	for i := 0; i < tbls.NumServe; i++ {
-		wg.Add(1)
-		go xmlFetcher(tbls, &wg, inp, out)
-	}
-
-	// launch separate anonymous goroutine to wait until all fetchers are done
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
-
-	return out
+	return cols
 }
 
-func CreateTermListReader(in io.Reader, tbls *Tables) <-chan Extract {
+// ParseAggregateFuncs converts count,sum:3,median:3 style lists of summary functions
+func ParseAggregateFuncs(str string) []AggregateFunc {
 
-	if in == nil || tbls == nil {
-		return nil
-	}
+	var funcs []AggregateFunc
 
-	out := make(chan Extract, tbls.ChanDepth)
-	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create term list reader channel\n")
-		os.Exit(1)
-	}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
 
-	// termReader reads uids and terms from input stream and sends through channel
-	termReader := func(in io.Reader, out chan<- Extract) {
+		name, col := SplitInTwoAt(item, ":", LEFT)
+		name = strings.ToLower(name)
 
-		// close channel when all records have been processed
-		defer close(out)
+		needsCol, ok := aggregateFuncIs[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized -aggregate function '%s'\n", name)
+			os.Exit(1)
+		}
 
-		var buffer bytes.Buffer
+		fn := AggregateFunc{Name: name}
+		if needsCol {
+			cols := ParseColumnList(col, "-aggregate")
+			if len(cols) != 1 {
+				fmt.Fprintf(os.Stderr, "\nERROR: -aggregate function '%s' requires one column, e.g., %s:3\n", name, name)
+				os.Exit(1)
+			}
+			fn.Column = cols[0]
+		}
 
-		uid := ""
-		term := ""
-		prev := ""
-		count := 0
+		funcs = append(funcs, fn)
+	}
 
-		scanr := bufio.NewScanner(in)
+	return funcs
+}
 
-		idx := 0
-		for scanr.Scan() {
+// AddValue records one column value for a summary function, ignoring non-numeric values in numeric functions
+func (state *AggregateState) AddValue(name, str string) {
 
-			// read lines of uid and term groups
-			line := scanr.Text()
-			idx++
+	if name == "distinct" {
+		if str == "" {
+			return
+		}
+		if state.Distinct == nil {
+			state.Distinct = make(map[string]bool)
+		}
+		state.Distinct[str] = true
+		return
+	}
 
-			uid, term = SplitInTwoAt(line, "\t", LEFT)
+	_, flt, _, ok := ParseNumber(strings.TrimSpace(str))
+	if !ok {
+		return
+	}
 
-			if prev != "" && prev != term {
+	if state.Count == 0 || flt < state.Min {
+		state.Min = flt
+	}
+	if state.Count == 0 || flt > state.Max {
+		state.Max = flt
+	}
 
-				str := buffer.String()
-				out <- Extract{idx, prev, str}
+	// Welford algorithm for one-pass mean and standard deviation
+	state.Count++
+	state.Sum += flt
+	delta := flt - state.Mean
+	state.Mean += delta / float64(state.Count)
+	state.M2 += delta * (flt - state.Mean)
 
-				buffer.Reset()
-				count = 0
-			}
+	if name == "median" {
+		state.Values = append(state.Values, flt)
+	}
+}
 
-			buffer.WriteString(uid)
-			buffer.WriteString("\n")
-			count++
+// Result prints the summary value, or a dash if there were not enough numeric values
+func (state *AggregateState) Result(name string, rows int) string {
 
-			prev = term
-		}
+	// round computed fractions to four decimal places, dropping trailing zeros
+	rounded := func(flt float64) string {
+		return FormatFloat(math.Round(flt*10000) / 10000)
+	}
 
-		if count > 0 {
+	switch name {
+	case "count":
+		return strconv.Itoa(rows)
+	case "distinct":
+		return strconv.Itoa(len(state.Distinct))
+	}
 
-			str := buffer.String()
-			out <- Extract{idx, term, str}
+	if state.Count < 1 {
+		return "-"
+	}
 
-			buffer.Reset()
+	switch name {
+	case "sum":
+		return FormatFloat(state.Sum)
+	case "min":
+		return FormatFloat(state.Min)
+	case "max":
+		return FormatFloat(state.Max)
+	case "mean":
+		return rounded(state.Mean)
+	case "stddev":
+		// sample standard deviation, as in -dev
+		if state.Count < 2 {
+			return "-"
 		}
+		return rounded(math.Sqrt(state.M2 / float64(state.Count-1)))
+	case "median":
+		vals := state.Values
+		sort.Float64s(vals)
+		mid := len(vals) / 2
+		if len(vals)%2 == 1 {
+			return FormatFloat(vals[mid])
+		}
+		return rounded((vals[mid-1] + vals[mid]) / 2)
 	}
 
-	// launch single term reader goroutine
-	go termReader(in, out)
-
-	return out
+	return "-"
 }
 
-func CreatePosters(tbls *Tables, inp <-chan Extract) <-chan string {
+// CreateAggregator groups output rows by key columns, printing one table of summary values after all records
+func CreateAggregator(tbls *Tables, inp <-chan Extract, funcs []AggregateFunc, keys []int) <-chan Extract {
 
 	if tbls == nil || inp == nil {
 		return nil
 	}
 
-	out := make(chan string, tbls.ChanDepth)
+	out := make(chan Extract, tbls.ChanDepth)
 	if out == nil {
-		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create poster channel\n")
+		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create aggregator channel\n")
 		os.Exit(1)
 	}
 
-	// savePosting writes individual postings list to file accessed by radix trie
-	savePosting := func(text, id string, index int) {
+	// xmlAggregator splits each record result into rows and columns, updating the matching group
+	xmlAggregator := func(inp <-chan Extract, out chan<- Extract) {
 
-		var arry [516]rune
-		trie := MakePostingsTrie(id, arry)
-		if trie == "" {
-			return
-		}
+		// close channel when all records have been processed
+		defer close(out)
 
-		dpath := path.Join(tbls.Posting, trie)
-		if dpath == "" {
-			return
-		}
-		_, err := os.Stat(dpath)
-		if err != nil && os.IsNotExist(err) {
-			err = os.MkdirAll(dpath, os.ModePerm)
-		}
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
-		fpath := path.Join(dpath, "uids.txt")
-		if fpath == "" {
-			return
-		}
+		groups := make(map[string]*AggregateGroup)
+		var order []*AggregateGroup
+		last := 0
 
-		// appends if file exists, otherwise creates
-		fl, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
+		for ext := range inp {
 
-		fl.WriteString(text)
-		if !strings.HasSuffix(text, "\n") {
-			fl.WriteString("\n")
-		}
+			last = ext.Index
 
-		err = fl.Sync()
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-		fl.Close()
-	}
+			for _, line := range strings.Split(ext.Text, "\n") {
+				if line == "" {
+					continue
+				}
+				cols := strings.Split(line, "\t")
 
-	// xmlPoster reads from channel and calls savePosting
-	xmlPoster := func(wg *sync.WaitGroup, inp <-chan Extract, out chan<- string) {
+				column := func(col int) string {
+					if col <= len(cols) {
+						return cols[col-1]
+					}
+					return ""
+				}
 
-		defer wg.Done()
+				// keys are compared exactly, without case folding
+				var key []string
+				for _, col := range keys {
+					key = append(key, column(col))
+				}
+				id := strings.Join(key, "\t")
 
-		for ext := range inp {
+				grp, ok := groups[id]
+				if !ok {
+					grp = &AggregateGroup{Key: key}
+					for range funcs {
+						grp.States = append(grp.States, &AggregateState{})
+					}
+					groups[id] = grp
+					order = append(order, grp)
+				}
 
-			savePosting(ext.Text, ext.Ident, ext.Index)
+				grp.Rows++
+				for i, fn := range funcs {
+					if fn.Column > 0 {
+						grp.States[i].AddValue(fn.Name, column(fn.Column))
+					}
+				}
+			}
 
-			out <- ext.Ident
+			// send empty result to preserve record count
+			out <- Extract{ext.Index, ext.Ident, ""}
 		}
-	}
 
-	var wg sync.WaitGroup
+		// sort groups by key columns, comparing numbers numerically
+		sort.SliceStable(order, func(i, j int) bool {
+			a := order[i].Key
+			b := order[j].Key
+			for k := range a {
+				if a[k] == b[k] {
+					continue
+				}
+				_, fa, _, oka := ParseNumber(a[k])
+				_, fb, _, okb := ParseNumber(b[k])
+				if oka && okb && fa != fb {
+					return fa < fb
+				}
+				return a[k] < b[k]
+			}
+			return false
+		})
 
-	// launch multiple poster goroutines
-	for i := 0; i < tbls.NumServe; i++ {
-		wg.Add(1)
-		go xmlPoster(&wg, inp, out)
+		var buffer bytes.Buffer
+
+		for _, grp := range order {
+			between := ""
+			for _, str := range grp.Key {
+				buffer.WriteString(between)
+				buffer.WriteString(str)
+				between = "\t"
+			}
+			for i, fn := range funcs {
+				buffer.WriteString(between)
+				buffer.WriteString(grp.States[i].Result(fn.Name, grp.Rows))
+				between = "\t"
+			}
+			buffer.WriteString("\n")
+		}
+
+		txt := buffer.String()
+		if txt != "" {
+			out <- Extract{last + 1, "", txt}
+		}
 	}
 
-	// launch separate anonymous goroutine to wait until all posters are done
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
+	// launch single aggregator goroutine
+	go xmlAggregator(inp, out)
 
 	return out
 }
@@ -9601,6 +16176,9 @@ func main() {
 	// skip past executable name
 	args := os.Args[1:]
 
+	// replace -script arguments with contents of argument files, expanding includes and macros
+	args = ExpandScripts(args)
+
 	if len(args) < 1 {
 		fmt.Fprintf(os.Stderr, "\nERROR: No command-line arguments supplied to xtract\n")
 		os.Exit(1)
@@ -9644,6 +16222,9 @@ func main() {
 	deAccent := false
 	doASCII := false
 
+	// ASN.1 value notation input
+	doASN := false
+
 	// -flag sets -strict or -mixed cleanup flags from argument
 	flgs := ""
 
@@ -9695,6 +16276,39 @@ func main() {
 	// repeat the specified extraction 5 times for each -proc from 1 to nCPU
 	trial := false
 
+	// open reading frame sequence element, minimum length in residues, genetic code, and start codons
+	orfElem := ""
+	orfMin := 100
+	orfCode := 1
+	orfStarts := "ATG"
+
+	// records to skip, maximum records to process, reservoir sample size, and random seed
+	recSkip := 0
+	recLimit := 0
+	recSample := 0
+	recSeed := time.Now().UnixNano()
+
+	// key path for reordering whole records
+	srtb := ""
+
+	// element and name attribute for wide table of name and value pairs
+	pvot := ""
+
+	// variables that keep their values from one record to the next, with optional initial values
+	var prst []string
+	prstInit := make(map[string]string)
+
+	// key path for removing duplicate records, keeping first or last occurrence
+	uniq := ""
+	uniqLast := false
+
+	// summary functions and key columns for cross-record aggregation of output rows
+	aggr := ""
+	aggrBy := ""
+	hist := ""
+	histBins := ""
+	chart := ""
+
 	// get numeric value
 	getNumericArg := func(name string, zer, min, max int) int {
 
@@ -9788,6 +16402,35 @@ func main() {
 			dltd = args[1]
 			// skip past first of two arguments
 			args = args[1:]
+		// record selection
+		case "-skip-records":
+			recSkip = getNumericArg("Number of records to skip", 0, 0, math.MaxInt32)
+		case "-limit":
+			recLimit = getNumericArg("Record limit", 0, 1, math.MaxInt32)
+		case "-sample":
+			// -sample followed by a record type prints a sample record (undocumented)
+			if len(args) < 2 {
+				inSwitch = false
+				break
+			}
+			if _, err := strconv.Atoi(args[1]); err != nil {
+				inSwitch = false
+				break
+			}
+			recSample = getNumericArg("Sample size", 0, 1, math.MaxInt32)
+		case "-seed":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Random seed is missing\n")
+				os.Exit(1)
+			}
+			seed, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nERROR: Random seed (%s) is not an integer\n", args[1])
+				os.Exit(1)
+			}
+			recSeed = seed
+			// skip past first of two arguments
+			args = args[1:]
 		// local directory path for postings files (undocumented)
 		case "-posting", "-postings":
 			if len(args) < 2 {
@@ -9819,6 +16462,8 @@ func main() {
 			doCleanup = true
 		case "-strict":
 			doStrict = true
+		case "-asn":
+			doASN = true
 		case "-mixed", "-relaxed":
 			doMixed = true
 		case "-accent", "-plain":
@@ -9854,6 +16499,148 @@ func main() {
 			ignr = args[1]
 			// skip past first of two arguments
 			args = args[1:]
+		// additional coordinate mappings for sequence position conversion
+		case "-coord":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Coordinate mapping is missing after -coord\n")
+				os.Exit(1)
+			}
+			AddSequenceType(args[1])
+			// skip past first of two arguments
+			args = args[1:]
+		case "-coords":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Coordinate file is missing after -coords\n")
+				os.Exit(1)
+			}
+			ReadSequenceTypes(args[1])
+			// skip past first of two arguments
+			args = args[1:]
+		// open reading frame detection
+		case "-orf":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Sequence element is missing after -orf\n")
+				os.Exit(1)
+			}
+			orfElem = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		case "-orf-min":
+			orfMin = getNumericArg("Minimum ORF length", 1, 1, 100000)
+		case "-orf-code":
+			orfCode = getNumericArg("ORF genetic code", 1, 1, 33)
+			if _, ok := geneticCodeIs[orfCode]; !ok {
+				fmt.Fprintf(os.Stderr, "\nERROR: Unrecognized genetic code '%d'\n", orfCode)
+				os.Exit(1)
+			}
+		case "-orf-starts":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Start codons are missing after -orf-starts\n")
+				os.Exit(1)
+			}
+			orfStarts = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		// reorder records by extracted key
+		case "-sort-by":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Key path is missing after -sort-by\n")
+				os.Exit(1)
+			}
+			srtb = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		// cross-record variables
+		case "-persist":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Variable names are missing after -persist\n")
+				os.Exit(1)
+			}
+			for _, item := range strings.Split(args[1], ",") {
+				name, val := SplitInTwoAt(item, "=", LEFT)
+				name = strings.TrimPrefix(strings.TrimSpace(name), "&")
+				if name == "" || !IsAllCapsOrDigits(name) {
+					fmt.Fprintf(os.Stderr, "\nERROR: -persist variable '%s' must be an upper-case name\n", name)
+					os.Exit(1)
+				}
+				prst = append(prst, name)
+				if strings.Contains(item, "=") {
+					prstInit[name] = val
+				}
+			}
+			// skip past first of two arguments
+			args = args[1:]
+		// one column per distinct attribute name
+		case "-pivot":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Element@name is missing after -pivot\n")
+				os.Exit(1)
+			}
+			pvot = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		// keep one record per extracted key
+		case "-unique-by":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Key path is missing after -unique-by\n")
+				os.Exit(1)
+			}
+			uniq = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+			// optional first or last selection
+			if len(args) > 1 && (args[1] == "first" || args[1] == "last") {
+				uniqLast = (args[1] == "last")
+				args = args[1:]
+			}
+		// cross-record aggregation
+		case "-aggregate":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Functions are missing after -aggregate\n")
+				os.Exit(1)
+			}
+			aggr = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		case "-by":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Key columns are missing after -by\n")
+				os.Exit(1)
+			}
+			aggrBy = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		// binned counts of one column across all records
+		case "-histogram":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Value column is missing after -histogram\n")
+				os.Exit(1)
+			}
+			hist = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+			// optional bin width or scale
+			if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+				histBins = args[1]
+				args = args[1:]
+			}
+		case "-chart":
+			if len(args) < 2 || (args[1] != "bar" && args[1] != "line") {
+				fmt.Fprintf(os.Stderr, "\nERROR: -chart must be followed by bar or line\n")
+				os.Exit(1)
+			}
+			chart = args[1]
+			// skip past first of two arguments
+			args = args[1:]
+		// tab-delimited key and value table for -map and -in-lookup
+		case "-lookup":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "\nERROR: Lookup file is missing after -lookup\n")
+				os.Exit(1)
+			}
+			ReadLookupTable(args[1])
+			// skip past first of two arguments
+			args = args[1:]
 		case "-missing":
 			msng = true
 		case "-debug":
@@ -9944,6 +16731,16 @@ func main() {
 		numServers = numProcs
 	}
 
+	// -persist variables require records to be processed one at a time, in order
+	if len(prst) > 0 {
+		if trial {
+			// -trial varies the number of servers
+			fmt.Fprintf(os.Stderr, "\nERROR: -persist cannot be combined with -trial\n")
+			os.Exit(1)
+		}
+		numServers = 1
+	}
+
 	// explicit -chan argument overrides default to number of servers
 	if chanDepth == 0 {
 		chanDepth = numServers
@@ -10079,6 +16876,22 @@ func main() {
 	// base location of local postings directory
 	tbls.Posting = pstg
 
+	if srtb != "" {
+		if indx != "" {
+			fmt.Fprintf(os.Stderr, "\nERROR: Cannot combine -sort-by with -index\n")
+			os.Exit(1)
+		}
+
+		// -sort-by key uses the same identifier matching as -index
+		prnt, match := SplitInTwoAt(srtb, "/", RIGHT)
+		match, attrib := SplitInTwoAt(match, "@", LEFT)
+
+		tbls.Index = srtb
+		tbls.Parent = prnt
+		tbls.Match = match
+		tbls.Attrib = attrib
+	}
+
 	if indx != "" {
 
 		// parse parent/element@attribute index
@@ -10098,6 +16911,33 @@ func main() {
 	tbls.DeAccent = deAccent
 	tbls.DoASCII = doASCII
 
+	// cross-record variables
+	tbls.Persist = prst
+	tbls.Persisted = prstInit
+
+	// record selection parameters
+	tbls.RecSkip = recSkip
+	tbls.RecLimit = recLimit
+	tbls.RecSample = recSample
+	tbls.RecSeed = recSeed
+	if recLimit > 0 {
+		// closed by the limiter to stop the producer
+		tbls.RecDone = make(chan bool)
+	}
+
+	// open reading frame parameters
+	tbls.OrfElem = orfElem
+	tbls.OrfMin = orfMin
+	tbls.OrfCode = orfCode
+	for _, str := range strings.Split(orfStarts, ",") {
+		str = strings.ToUpper(strings.TrimSpace(str))
+		if len(str) != 3 {
+			fmt.Fprintf(os.Stderr, "\nERROR: Start codon '%s' must have three bases\n", str)
+			os.Exit(1)
+		}
+		tbls.OrfStarts = append(tbls.OrfStarts, str)
+	}
+
 	// FILE NAME CAN BE SUPPLIED WITH -input COMMAND
 
 	in := os.Stdin
@@ -10167,9 +17007,34 @@ func main() {
 		return
 	}
 
+	// INTERVAL SET OPERATIONS
+
+	// -intervals reads chromosome, start, and stop columns instead of XML
+	if args[0] == "-intervals" {
+
+		ProcessIntervals(in, args[1:])
+
+		return
+	}
+
+	// CONVERT ASN.1 VALUE NOTATION TO XML
+
+	// -asn forces conversion, otherwise input starting with a "Type ::=" assignment is detected
+	var src io.Reader = in
+	if doASN {
+		src = ConvertASN(in)
+	} else if isPipe || usingFile {
+		brd := bufio.NewReaderSize(in, 65536)
+		if IsASNInput(brd) {
+			src = ConvertASN(brd)
+		} else {
+			src = brd
+		}
+	}
+
 	// CREATE XML BLOCK READER FROM STDIN OR FILE
 
-	rdr := NewXMLReader(in, doCompress, doCleanup, doStrict || doMixed)
+	rdr := NewXMLReader(src, doCompress, doCleanup, doStrict || doMixed)
 	if rdr == nil {
 		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create XML Block Reader\n")
 		os.Exit(1)
@@ -10226,6 +17091,82 @@ func main() {
 		args = insd
 	}
 
+	// CODON USAGE COMMAND GENERATOR
+
+	// -codon-usage tabulates CDS codons for each record or for the entire data stream
+	codonMode := ""
+	if args[0] == "-codon-usage" {
+
+		codonMode = "aggregate"
+		args = args[1:]
+
+		if len(args) > 0 && (args[0] == "record" || args[0] == "aggregate") {
+			codonMode = args[0]
+			args = args[1:]
+		}
+
+		// custom extraction arguments can follow, but must produce -codons output
+		if len(args) < 1 {
+			args = ProcessCodonUsage(isPipe || usingFile)
+		}
+
+		if !isPipe && !usingFile {
+			// no piped input, so write output instructions
+			fmt.Printf("xtract -codon-usage %s", codonMode)
+			for _, str := range args {
+				fmt.Printf(" %s", str)
+			}
+			fmt.Printf("\n")
+			return
+		}
+	}
+
+	// TAXONOMY TREE COMMAND GENERATOR
+
+	// -taxonomy assembles Taxon records into a tree for lineages, common ancestors, or Newick export
+	taxMode := ""
+	var taxSets []string
+	if args[0] == "-taxonomy" {
+
+		args = args[1:]
+
+		if len(args) < 1 || (args[0] != "lineage" && args[0] != "lca" && args[0] != "newick") {
+			fmt.Fprintf(os.Stderr, "\nERROR: -taxonomy must be followed by lineage, lca, or newick\n")
+			os.Exit(1)
+		}
+
+		taxMode = args[0]
+		args = args[1:]
+
+		// taxid sets or files of sets precede any custom extraction arguments
+		var sets []string
+		if taxMode == "lca" {
+			for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+				sets = append(sets, args[0])
+				args = args[1:]
+			}
+		}
+
+		if len(args) < 1 {
+			args = ProcessTaxonomy(isPipe || usingFile)
+		}
+
+		if !isPipe && !usingFile {
+			// no piped input, so write output instructions
+			fmt.Printf("xtract -taxonomy %s", taxMode)
+			for _, str := range sets {
+				fmt.Printf(" %s", str)
+			}
+			for _, str := range args {
+				fmt.Printf(" %s", str)
+			}
+			fmt.Printf("\n")
+			return
+		}
+
+		taxSets = ReadTaxonSets(sets)
+	}
+
 	// CITATION MATCHER EXTRACTION COMMAND GENERATOR
 
 	// -hydra filters HydraResponse output by relevance score (undocumented)
@@ -10270,6 +17211,29 @@ func main() {
 		args = res
 	}
 
+	// XPATH SUBSET COMMAND GENERATOR
+
+	// -xpath compiles record path and column expressions into exploration and extraction arguments
+	if args[0] == "-xpath" {
+
+		args = args[1:]
+
+		res := ProcessXPath(args, isPipe || usingFile)
+
+		if !isPipe && !usingFile {
+			// no piped input, so write output instructions
+			fmt.Printf("xtract")
+			for _, str := range res {
+				fmt.Printf(" %s", str)
+			}
+			fmt.Printf("\n")
+			return
+		}
+
+		// data in pipe, so replace arguments, execute dynamically
+		args = res
+	}
+
 	// CONFIRM INPUT DATA AVAILABILITY AFTER RUNNING COMMAND GENERATORS
 
 	if fileName == "" && runtime.GOOS != "windows" {
@@ -10808,6 +17772,9 @@ func main() {
 		xmlq := CreateProducer(topPattern, star, rdr, tbls)
 		idnq := CreateExaminers(tbls, parent, xmlq)
 		unsq := CreateUnshuffler(tbls, idnq)
+		if tbls.RecLimit > 0 {
+			unsq = CreateLimiter(tbls, unsq)
+		}
 		unqq := CreateUniquer(tbls, unsq)
 		delq := unqq
 		if dltd != "" {
@@ -10887,6 +17854,73 @@ func main() {
 		return
 	}
 
+	// SORT XML RECORDS BY EXTRACTED KEY
+
+	// -sort-by plus -pattern writes whole records in key order, spilling sorted runs to temporary files
+	if srtb != "" {
+
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "\nERROR: -sort-by writes whole records, and only takes -pattern\n")
+			os.Exit(1)
+		}
+
+		xmlq := CreateProducer(topPattern, star, rdr, tbls)
+		idnq := CreateExaminers(tbls, parent, xmlq)
+		unsq := CreateUnshuffler(tbls, idnq)
+		if tbls.RecLimit > 0 {
+			unsq = CreateLimiter(tbls, unsq)
+		}
+		// sorted runs of up to 256 MB are kept in memory
+		srtq := CreateRecordSorter(tbls, unsq, 1<<28)
+
+		if xmlq == nil || idnq == nil || unsq == nil || srtq == nil {
+			fmt.Fprintf(os.Stderr, "\nERROR: Unable to create sort servers\n")
+			os.Exit(1)
+		}
+
+		wrtr := bufio.NewWriter(os.Stdout)
+
+		if head != "" {
+			wrtr.WriteString(head)
+			wrtr.WriteString("\n")
+		}
+
+		for ext := range srtq {
+
+			recordCount++
+
+			if hd != "" {
+				wrtr.WriteString(hd)
+				wrtr.WriteString("\n")
+			}
+
+			// write sorted record
+			str := ext.Text
+			wrtr.WriteString(str)
+			if !strings.HasSuffix(str, "\n") {
+				wrtr.WriteString("\n")
+			}
+
+			if tl != "" {
+				wrtr.WriteString(tl)
+				wrtr.WriteString("\n")
+			}
+		}
+
+		if tail != "" {
+			wrtr.WriteString(tail)
+			wrtr.WriteString("\n")
+		}
+
+		wrtr.Flush()
+
+		if timr {
+			printDuration("records")
+		}
+
+		return
+	}
+
 	// FILTER XML RECORDS BY PRESENCE OF ONE OR MORE PHRASES
 
 	// -phrase plus -pattern filters by phrase in XML
@@ -10985,6 +18019,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	if pvot != "" {
+		// -pivot name and value pairs are extracted from each record by a separate instruction
+		tbls.PivotCmds = ParseArguments(PivotArguments(topPat, pvot), topPattern)
+	}
+
+	if uniq != "" {
+		// -unique-by key is extracted from each record by a separate instruction
+		tbls.UniqueKey = ParseArguments([]string{args[0], topPat, "-sep", "\t", "-element", uniq}, topPattern)
+	}
+
 	// PERFORMANCE TIMING COMMAND
 
 	// -stats with an extraction command prints XML size and processing time for each record
@@ -11105,6 +18149,8 @@ func main() {
 					if rec == 1 {
 						qry = str
 						idx = rec
+						// no need to read further
+						rdr.Closed = true
 					}
 				})
 
@@ -11130,6 +18176,8 @@ func main() {
 					if rec == number {
 						qry = str
 						idx = rec
+						// no need to read further
+						rdr.Closed = true
 					}
 				})
 		}
@@ -11162,6 +18210,60 @@ func main() {
 	// launch unshuffler goroutine to restore order of results
 	unsq := CreateUnshuffler(tbls, tblq)
 
+	if uniq != "" {
+		// blank records whose key was already seen, or will be seen again with -unique-by PATH last
+		unsq = CreateUniqueFilter(tbls, unsq, uniqLast)
+	}
+
+	if recLimit > 0 {
+		// stop reading once enough results are written
+		unsq = CreateLimiter(tbls, unsq)
+	}
+
+	if pvot != "" {
+		// replace records with header of attribute names and one row per record
+		unsq = CreatePivoter(tbls, unsq)
+	}
+
+	if codonMode != "" {
+		// replace codon counts with usage tables
+		unsq = CreateCodonTabulator(tbls, unsq, codonMode == "aggregate")
+	}
+
+	if taxMode != "" {
+		// replace Taxon records with lineages, common ancestors, or Newick tree
+		unsq = CreateTaxonomyBuilder(tbls, unsq, taxMode, taxSets)
+	}
+
+	if hist != "" {
+		if aggr != "" {
+			fmt.Fprintf(os.Stderr, "\nERROR: -histogram cannot be combined with -aggregate\n")
+			os.Exit(1)
+		}
+		cols := ParseColumnList(hist, "-histogram")
+		byCols := ParseColumnList(aggrBy, "-by")
+		if len(cols) != 1 || len(byCols) > 1 {
+			fmt.Fprintf(os.Stderr, "\nERROR: -histogram and -by each take a single column\n")
+			os.Exit(1)
+		}
+		byCol := 0
+		if len(byCols) > 0 {
+			byCol = byCols[0]
+		}
+		// replace rows with counts per bin, optionally drawn as an SVG chart
+		unsq = CreateHistogram(tbls, unsq, cols[0], ParseHistogramBins(histBins), byCol, chart)
+	} else if chart != "" {
+		fmt.Fprintf(os.Stderr, "\nERROR: -chart requires -histogram\n")
+		os.Exit(1)
+	} else if aggr != "" || aggrBy != "" {
+		// -by without -aggregate counts rows for each key
+		if aggr == "" {
+			aggr = "count"
+		}
+		// replace rows with one summary table
+		unsq = CreateAggregator(tbls, unsq, ParseAggregateFuncs(aggr), ParseColumnList(aggrBy, "-by"))
+	}
+
 	if xmlq == nil || tblq == nil || unsq == nil {
 		fmt.Fprintf(os.Stderr, "\nERROR: Unable to create servers\n")
 		os.Exit(1)